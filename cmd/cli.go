@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -25,7 +28,7 @@ var (
 			if cmd.Name() == "help" {
 				return
 			}
-			updateSettings()
+			updateSettings(cmd)
 		},
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Usage()
@@ -40,34 +43,265 @@ var (
 	}
 
 	connectCmd = &cobra.Command{
-		Use:   "connect CONNECTION",
+		Use:   "connect [CONNECTION]",
 		Short: "Connect to a host",
-		Long:  "Connect to a host using the stored configuration",
+		Long:  "Connect to a host using the stored configuration, choosing from the available connections when none is specified",
+		Run: func(cmd *cobra.Command, args []string) {
+			vc := getVaultClient()
+			connect(vc, ssh.UserEnv{User: cfg.User, Simulate: cfg.Simulate}, pickConnection(vc, args))
+		},
+	}
+
+	copyCmd = &cobra.Command{
+		Use:   "copy CONNECTION [NEW_NAME] [flags]",
+		Short: "Copy a connection",
+		Long: `Copy a connection to a new name and/or namespace, including the comment, MOTD and tags.
+The new name can be qualified with the namespace, e.g. namespace:name. Use cp to copy files.`,
+		Example: `
+	ssh_ms copy gateway gateway-eu
+	ssh_ms copy gateway --to-namespace secret/other
+        `,
 		Run: func(cmd *cobra.Command, args []string) {
 			checkArgs(args, 1)
-			connect(getVaultClient(), ssh.UserEnv{User: cfg.User, Simulate: cfg.Simulate}, args)
+			dest := ""
+			if len(args) > 1 {
+				dest = args[1]
+			}
+			if !moveConnection(getVaultClient(), args[0], dest, true) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cpCmd = &cobra.Command{
+		Use:   "cp [-- SCP_FLAGS] SOURCE... TARGET",
+		Short: "Copy files using scp",
+		Long: `Copy files to or from a connection using scp, with remote paths specified as CONNECTION:path.
+The port, identity, jump hosts, templated user and ControlPath are the same as for connect.`,
+		Example: `
+	ssh_ms cp gateway:/var/log/syslog .
+	ssh_ms cp -- -r ./configs gateway:/tmp/
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 2)
+			if !transferFiles(getVaultClient(), "scp", args) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	ctlCmd = &cobra.Command{
+		Use:   "ctl",
+		Short: "ControlMaster management",
+		Long:  "Manage the ControlMaster sessions kept in " + cfg.StoragePath,
+	}
+
+	ctlListCmd = &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List the running masters",
+		Long:  "List every running master, along with the local ports allocated for forwarding",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !ctlList() {
+				os.Exit(1)
+			}
+		},
+	}
+
+	ctlStatusCmd = &cobra.Command{
+		Use:   "status CONNECTION [flags]",
+		Short: "Check the master for a connection",
+		Long:  "Check whether a master is running for a connection using ssh -O check",
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			if !ctlStatus(getVaultClient(), args[0]) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	ctlStopCmd = &cobra.Command{
+		Use:   "stop CONNECTION [flags]",
+		Short: "Stop the master for a connection",
+		Long:  "Request that the master for a connection exits using ssh -O exit, releasing its forwarded ports",
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			if !ctlStop(getVaultClient(), args[0]) {
+				os.Exit(1)
+			}
 		},
 	}
 
 	deleteCmd = &cobra.Command{
 		Use:   "delete CONNECTION [flags]",
 		Short: "Delete a connection",
-		Long:  "Lookup the requested connection and remove it when present",
+		Long: `Lookup the requested connection and remove it when present.
+On KV v2 mounts only the latest version is deleted, which can be restored using undelete.`,
+		Example: `
+	ssh_ms delete gateway
+	ssh_ms delete gateway --purge
+        `,
 		Run: func(cmd *cobra.Command, args []string) {
 			checkArgs(args, 1)
-			deleteConnection(getVaultClient(), args[0])
+			deleteConnection(getVaultClient(), args[0], deletePurge)
+		},
+	}
+
+	diffCmd = &cobra.Command{
+		Use:   "diff CONNECTION [flags]",
+		Short: "Compare revisions of a connection",
+		Long:  "Display the changes between two revisions of a connection stored in a KV v2 mount",
+		Example: `
+	ssh_ms diff gateway
+	ssh_ms diff gateway --from 2 --to 5
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			if !diffConnection(getVaultClient(), args[0], diffFrom, diffTo) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	execCmd = &cobra.Command{
+		Use:   "exec --pattern REGEX|--tag KEY=VALUE [flags] -- COMMAND",
+		Short: "Run a command on many connections",
+		Long: `Run a command on each connection that matches the pattern and tags, using a pool of workers.
+Each line of output is prefixed with the connection, followed by a summary of the exit codes.`,
+		Example: `
+	ssh_ms exec --pattern '^acme-db' -- mysql --version
+	ssh_ms exec --pattern '^acme-' --parallel 4 -- df -h
+	ssh_ms exec --pattern '^acme-' --json -- uptime
+	ssh_ms exec --tag env=prod --tag customer=acme -- uptime
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !execConnections(getVaultClient(), execPattern, args) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	forwardCmd = &cobra.Command{
+		Use:   "forward",
+		Short: "Forward management",
+		Long:  "Manage the forwards for a running master without reconnecting",
+	}
+
+	forwardAddCmd = &cobra.Command{
+		Use:   "add CONNECTION PORT [flags]",
+		Short: "Add a forward to a running master",
+		Long: `Allocate a local port and add a LocalForward to the running master using ssh -O forward.
+PORT is either the name of a stored forward or service, a port, or a service definition.`,
+		Example: `
+	ssh_ms forward add gateway 3306
+	ssh_ms forward add gateway mysql
+	ssh_ms forward add gateway http://:9090/graph
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 2)
+			if !forwardAdd(getVaultClient(), args[0], args[1]) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	forwardCancelCmd = &cobra.Command{
+		Use:   "cancel CONNECTION PORT [flags]",
+		Short: "Remove a forward from a running master",
+		Long:  "Remove a LocalForward from the running master using ssh -O cancel",
+		Example: `
+	ssh_ms forward cancel gateway 3306
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 2)
+			if !forwardCancel(getVaultClient(), args[0], args[1]) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	historyCmd = &cobra.Command{
+		Use:   "history CONNECTION [flags]",
+		Short: "Show the revisions of a connection",
+		Long:  "List the revisions of a connection stored in a KV v2 mount",
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			if !historyConnection(getVaultClient(), args[0]) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	importCmd = &cobra.Command{
+		Use:   "import [FILE] [flags]",
+		Short: "Import connections from an ssh_config file",
+		Long:  "Read the Host entries from an OpenSSH client config, following Include directives, and add each one to storage",
+		Example: `
+	ssh_ms import
+	ssh_ms import ~/.ssh/config.d/customers --dry-run
+	ssh_ms import ~/.ssh/config --namespace secret/my-special-namespace
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			path := filepath.Join("~", ".ssh", "config")
+			if len(args) > 0 {
+				path = args[0]
+			}
+
+			var vc *vaultApi.Client
+			if !cfg.Simulate {
+				vc = getVaultClient()
+			}
+			if !importConnections(vc, path) {
+				os.Exit(1)
+			}
 		},
 	}
 
 	listCmd = &cobra.Command{
 		Use:   "list [flags]",
 		Short: "List available connections",
-		Long:  "Lookup available connections in Vault and list them",
+		Long: `Lookup available connections in Vault and list them.
+With -l the namespace, HostName, Port, User, ProxyJump and comment are also displayed, using the local cache where possible.`,
+		Example: `
+	ssh_ms list
+	ssh_ms list -l
+	ssh_ms list -l --sort host
+        `,
 		Run: func(cmd *cobra.Command, args []string) {
 			listConnections(getVaultClient())
 		},
 	}
 
+	locksCmd = &cobra.Command{
+		Use:   "locks",
+		Short: "Lock management",
+		Long:  "Manage the locks used to control writes to connections",
+	}
+
+	listLocksCmd = &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List the current locks",
+		Long:  "List the locks in each namespace, along with the user that holds them",
+		Run: func(cmd *cobra.Command, args []string) {
+			listLocks(getVaultClient())
+		},
+	}
+
+	breakLockCmd = &cobra.Command{
+		Use:   "break CONNECTION [flags]",
+		Short: "Remove the lock for a connection",
+		Long:  "Remove an expired lock for a connection, or any lock when using --force",
+		Example: `
+	ssh_ms locks break gateway
+	ssh_ms locks break gateway --force
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			if !breakLock(getVaultClient(), args[0], lockForce) {
+				os.Exit(1)
+			}
+		},
+	}
+
 	populateCacheCmd = &cobra.Command{
 		Use:   "populate [flags]",
 		Short: "Populate your local cache for all available connections",
@@ -79,13 +313,46 @@ var (
 		},
 	}
 
+	cacheStatusCmd = &cobra.Command{
+		Use:   "status [flags]",
+		Short: "Show the cached connections",
+		Long:  "List the connections in your local cache, along with when they will expire",
+		Run: func(cmd *cobra.Command, args []string) {
+			if !cacheStatus() {
+				os.Exit(1)
+			}
+		},
+	}
+
+	mvCmd = &cobra.Command{
+		Use:   "mv CONNECTION [NEW_NAME] [flags]",
+		Short: "Move or rename a connection",
+		Long: `Move a connection to a new name and/or namespace, including the comment, MOTD and tags.
+The new name can be qualified with the namespace, e.g. namespace:name. The original is only
+deleted once the copy has been written, and on KV v2 mounts it can be restored using undelete.`,
+		Example: `
+	ssh_ms mv old-name new-name
+	ssh_ms mv gateway --to-namespace secret/other
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			dest := ""
+			if len(args) > 1 {
+				dest = args[1]
+			}
+			if !moveConnection(getVaultClient(), args[0], dest, false) {
+				os.Exit(1)
+			}
+		},
+	}
+
 	printCmd = &cobra.Command{
-		Use:   "print CONNECTION [flags]",
+		Use:   "print [CONNECTION] [flags]",
 		Short: "Print out the SSH command for a connection",
 		Long:  "Print full command that would be used to connect",
 		Run: func(cmd *cobra.Command, args []string) {
-			checkArgs(args, 1)
-			printConnection(getVaultClient(), args[0])
+			vc := getVaultClient()
+			printConnection(vc, pickConnection(vc, args)[0])
 		},
 	}
 
@@ -104,31 +371,106 @@ var (
 		},
 	}
 
+	rollbackCmd = &cobra.Command{
+		Use:   "rollback CONNECTION --version N [flags]",
+		Short: "Restore a previous revision of a connection",
+		Long:  "Restore a previous revision of a connection stored in a KV v2 mount as the latest version",
+		Example: `
+	ssh_ms rollback gateway --version 3
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			if !rollbackConnection(getVaultClient(), args[0], rollbackVersion) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	rsyncCmd = &cobra.Command{
+		Use:   "rsync [-- RSYNC_FLAGS] SOURCE... TARGET",
+		Short: "Synchronise files using rsync",
+		Long: `Synchronise files to or from a connection using rsync, with remote paths specified as CONNECTION:path.
+The port, identity, jump hosts, templated user and ControlPath are the same as for connect.`,
+		Example: `
+	ssh_ms rsync -- -avz gateway:/var/log/ ./logs/
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 2)
+			if !transferFiles(getVaultClient(), "rsync", args) {
+				os.Exit(1)
+			}
+		},
+	}
+
 	searchCmd = &cobra.Command{
 		Use:   "search PATTERN [flags]",
 		Short: "Search for a connection",
-		Long:  "Search the list of connections using a pattern",
+		Long: `Search the list of connections using a pattern and/or tags.
+With --field the pattern is matched against an option, rather than the name, using the local cache where possible.`,
 		Example: `
 	ssh_ms search gate
 	ssh_ms search '^g.*'
 	ssh_ms search 'way$'
+	ssh_ms search 'way$' --tag env=prod
+	ssh_ms search --tag env=prod --tag customer=acme
+	ssh_ms search --field HostName '^10\.2\.3\.4$'
+	ssh_ms search --field any acme
         `,
 		Run: func(cmd *cobra.Command, args []string) {
-			checkArgs(args, 1)
-			searchConnections(getVaultClient(), args[0])
+			pattern := ".*"
+			if len(tagFilters) == 0 {
+				checkArgs(args, 1)
+			}
+			if len(args) > 0 {
+				pattern = args[0]
+			}
+			searchConnections(getVaultClient(), pattern)
 		},
 	}
 
 	showCmd = &cobra.Command{
-		Use:   "show CONNECTION [flags]",
+		Use:   "show [CONNECTION] [flags]",
 		Short: "Display a connection",
 		Long:  "Display the SSH config for the requested connection",
 		Example: `
     ssh_ms show gateway
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			vc := getVaultClient()
+			showConnection(vc, pickConnection(vc, args)[0])
+		},
+	}
+
+	sftpCmd = &cobra.Command{
+		Use:   "sftp [-- SFTP_FLAGS] CONNECTION[:path]",
+		Short: "Start an sftp session",
+		Long: `Start an interactive sftp session for a connection.
+The port, identity, jump hosts, templated user and ControlPath are the same as for connect.`,
+		Example: `
+	ssh_ms sftp gateway
+	ssh_ms sftp gateway:/var/log
         `,
 		Run: func(cmd *cobra.Command, args []string) {
 			checkArgs(args, 1)
-			showConnection(getVaultClient(), args[0])
+			if !sftpConnection(getVaultClient(), args) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	syncConfigCmd = &cobra.Command{
+		Use:   "sync-config [flags]",
+		Short: "Export all connections to an ssh_config file",
+		Long:  "Render every available connection into a single ssh_config file that can be included from ~/.ssh/config",
+		Example: `
+	ssh_ms sync-config
+	ssh_ms sync-config --user first.last --file ~/.ssh/config.d/ssh_ms.conf
+	ssh_ms sync-config --dry-run
+        `,
+		Run: func(cmd *cobra.Command, args []string) {
+			if !syncConfig(getVaultClient()) {
+				os.Exit(1)
+			}
 		},
 	}
 
@@ -141,6 +483,18 @@ var (
 		},
 	}
 
+	undeleteCmd = &cobra.Command{
+		Use:   "undelete CONNECTION [flags]",
+		Short: "Restore a deleted connection",
+		Long:  "Restore a connection stored in a KV v2 mount when its latest version has been deleted",
+		Run: func(cmd *cobra.Command, args []string) {
+			checkArgs(args, 1)
+			if !undeleteConnection(getVaultClient(), args[0]) {
+				os.Exit(1)
+			}
+		},
+	}
+
 	updateCmd = &cobra.Command{
 		Use:   "update CONNECTION [args]",
 		Short: "Update an existing connection to storage",
@@ -182,6 +536,20 @@ var (
 
 	*/
 
+	// Delete flags
+	deletePurge bool
+
+	// List flags
+	listLong bool
+	listSort string
+
+	// Search flags
+	searchField string
+
+	// Tag flags
+	connectionTags []string
+	tagFilters     []string
+
 	// Purge flags
 	purgeConnection string
 	purgeForce      bool
@@ -192,22 +560,53 @@ var (
 
 func init() {
 	cacheCmd.AddCommand(
+		cacheStatusCmd,
 		populateCacheCmd,
 		purgeCacheCmd,
 	)
+	ctlCmd.AddCommand(
+		ctlListCmd,
+		ctlStatusCmd,
+		ctlStopCmd,
+	)
+	forwardCmd.AddCommand(
+		forwardAddCmd,
+		forwardCancelCmd,
+	)
+	locksCmd.AddCommand(
+		breakLockCmd,
+		listLocksCmd,
+	)
 	rootCmd.AddCommand(
 		cacheCmd,
 		connectCmd,
+		copyCmd,
+		cpCmd,
+		ctlCmd,
 		deleteCmd,
+		diffCmd,
+		execCmd,
+		forwardCmd,
+		historyCmd,
+		importCmd,
 		inspectCmd,
 		listCmd,
+		locksCmd,
+		mvCmd,
 		printCmd,
+		rollbackCmd,
+		rsyncCmd,
 		searchCmd,
+		sftpCmd,
 		showCmd,
+		syncConfigCmd,
 		versionCmd,
+		undeleteCmd,
 		updateCmd,
 		writeCmd,
 	)
+	rootCmd.PersistentFlags().StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "Location of the config file")
+	rootCmd.PersistentFlags().StringVar(&cfg.Profile, "profile", cfg.Profile, "Select a profile from the config file (overrides "+config.EnvProfile+")")
 	rootCmd.PersistentFlags().StringVar(&cfg.VaultAddr, "vault-addr", cfg.EnvVaultAddr, "Specify the Vault address")
 	rootCmd.PersistentFlags().StringVar(&cfg.VaultToken, "vault-token", os.Getenv(vaultApi.EnvVaultToken), "Specify the Vault token")
 
@@ -216,12 +615,25 @@ func init() {
 
 	rootCmd.PersistentFlags().BoolVarP(&cfg.StoredToken, "stored-token", "", false,
 		"Use a stored token from 'vault login' (overrides --vault-token, auto-enabled when no token is specified)")
+	rootCmd.PersistentFlags().StringVarP(&cfg.Output, "output", "o", outputText,
+		"Output format for list, search, show, print, version, inspect and cache status: "+strings.Join(outputFormats, "|"))
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Debug, "debug", "d", false, "Provide addition output")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Simulate, "dry-run", "n", false, "Prevent certain commands without full execution")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Verbose, "verbose", "v", false, "Provide addition output")
 
 	connectCmd.Flags().StringVarP(&cfg.CustomLocalForward, "local-forward", "l", "",
 		"Define adhoc LocalForward rules by specifying the target ports, e.g. -l 8080,3306")
+	connectCmd.Flags().StringVar(&cfg.SocksPort, "socks", "",
+		"Start a SOCKS proxy using DynamicForward, optionally specifying the port, e.g. --socks=1080")
+	connectCmd.Flags().Lookup("socks").NoOptDefVal = "auto"
+	connectCmd.Flags().StringVar(&cfg.PacFile, "pac", "", "Write a PAC file for the SOCKS proxy to this location")
+
+	syncConfigCmd.Flags().StringVarP(&syncConfigPath, "file", "f", syncConfigPath, "Destination for the generated ssh_config")
+
+	breakLockCmd.Flags().BoolVarP(&lockForce, "force", "f", false, "Remove the lock even if it has not expired")
+	locksCmd.PersistentFlags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the lock")
+
+	deleteCmd.Flags().BoolVar(&deletePurge, "purge", false, "Permanently remove all versions of the connection")
 
 	purgeCacheCmd.Flags().BoolVarP(&purgeForce, "force", "f", false, "Bypass confirmation prompt")
 	purgeCacheCmd.Flags().StringVarP(&purgeConnection, "connection", "c", "", "Select a connection to purge")
@@ -233,12 +645,47 @@ func init() {
 	writeCmd.Flags().StringVarP(&cfg.ConfigMotd, "motd", "m", "", "Add a Motd comment for the config entry")
 
 	connectCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	copyCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	cpCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	ctlStatusCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	ctlStopCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
 	deleteCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	diffCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	execCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Limit the connections to a single namespace")
+	forwardCmd.PersistentFlags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	historyCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	importCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Set the namespace for the imported entries")
 	listCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	mvCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	rollbackCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	rsyncCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	sftpCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
 	showCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	undeleteCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Specify the namespace for the config entry")
+	syncConfigCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Limit the export to a single namespace")
 	updateCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Add a namespace for the config entry")
 	writeCmd.Flags().StringVarP(&cfg.NameSpace, "namespace", "N", "", "Set the namespace for the config entry")
 
+	execCmd.Flags().StringVarP(&execPattern, "pattern", "p", "", "Regular expression to select the connections")
+	execCmd.Flags().IntVarP(&execParallel, "parallel", "j", execParallel, "The maximum number of connections to run the command on at once")
+	execCmd.Flags().BoolVar(&execJSON, "json", false, "Collect the output and display it as JSON")
+
+	execCmd.Flags().StringArrayVarP(&tagFilters, "tag", "t", nil, "Only use connections with the tag, e.g. --tag env=prod")
+	listCmd.Flags().BoolVarP(&listLong, "long", "l", false, "Display the details for each connection")
+	listCmd.Flags().StringVar(&listSort, "sort", listSortName, "Order the connections by name, host or namespace")
+	listCmd.Flags().StringArrayVarP(&tagFilters, "tag", "t", nil, "Only list connections with the tag, e.g. --tag env=prod")
+	searchCmd.Flags().StringVarP(&searchField, "field", "f", "", "Match the pattern against an option, e.g. HostName, User, ConfigComment, ProxyJump or any")
+	searchCmd.Flags().StringArrayVarP(&tagFilters, "tag", "t", nil, "Only search connections with the tag, e.g. --tag env=prod")
+	updateCmd.Flags().StringArrayVarP(&connectionTags, "tag", "t", nil, "Set a tag, e.g. --tag env=prod, or remove it with --tag env=")
+	writeCmd.Flags().StringArrayVarP(&connectionTags, "tag", "t", nil, "Set a tag, e.g. --tag env=prod")
+
+	diffCmd.Flags().IntVar(&diffFrom, "from", 0, "The older revision to compare (default: the previous revision)")
+	diffCmd.Flags().IntVar(&diffTo, "to", 0, "The newer revision to compare (default: the latest revision)")
+	rollbackCmd.Flags().IntVar(&rollbackVersion, "version", 0, "The revision to restore")
+
+	copyCmd.Flags().StringVar(&moveNameSpace, "to-namespace", "", "The namespace for the copy")
+	mvCmd.Flags().StringVar(&moveNameSpace, "to-namespace", "", "The namespace to move the connection to")
+
 	versionCmd.Flags().BoolVarP(&cfg.VersionCheck, "check", "c", false, "Check for the latest version")
 
 	log := log.GetLogger(log.GetDefaultLevel(), "")
@@ -255,6 +702,20 @@ func checkArgs(args []string, min int) {
 // checkVersion against the latest release
 func checkVersion() [][]string {
 	var lines [][]string
+
+	if ver, url := getLatestVersion(); ver != Version {
+		lines = append(lines, []string{"Latest Version:", ver})
+		lines = append(lines, []string{"Download the latest version from", url})
+	} else {
+		lines = append(lines, []string{"You are using the latest version"})
+	}
+
+	return lines
+}
+
+// getLatestVersion looks up the latest release, returning the version
+// along with the URL to download it
+func getLatestVersion() (string, string) {
 	var redirectURL []string
 
 	url := "https://github.com/cezmunsta/ssh_ms/releases/latest"
@@ -272,23 +733,13 @@ func checkVersion() [][]string {
 		Timeout: time.Second * 10,
 	}
 
-	if _, err := client.Do(req); err != nil {
+	if _, err := client.Do(req); err != nil || len(redirectURL) == 0 {
 		log.Debugf("Request: %v", req)
 		log.Fatalf("Failed to lookup %s", url)
 	}
 
-	if parts := strings.Split(redirectURL[0], "/"); parts != nil {
-		ver := strings.Replace(parts[len(parts)-1], "v", "", 1)
-
-		if ver != Version {
-			lines = append(lines, []string{"Latest Version:", ver})
-			lines = append(lines, []string{"Download the latest version from", redirectURL[0]})
-		} else {
-			lines = append(lines, []string{"You are using the latest version"})
-		}
-	}
-
-	return lines
+	parts := strings.Split(redirectURL[0], "/")
+	return strings.Replace(parts[len(parts)-1], "v", "", 1), redirectURL[0]
 }
 
 // getVersion information for the application
@@ -307,12 +758,16 @@ func getVersion() [][]string {
 		lines = append(lines, []string{"Go Version:", runtime.Version()})
 		lines = append(lines, []string{"Vault API Version:", cfg.VaultAPIVersion})
 		lines = append(lines, []string{"Vault SDK Version:", cfg.VaultSDKVersion})
-		lines = append(lines, []string{"Base path:", config.EnvBasePath})
-		lines = append(lines, []string{"Namespaces:\n-", strings.Join(strings.Split(config.SecretPath, ","), "\n- ")})
-		lines = append(lines, []string{"Default Vault address:", config.EnvVaultAddr})
+		lines = append(lines, []string{"Config file:", cfg.ConfigFile})
+		if cfg.Profile != "" {
+			lines = append(lines, []string{"Profile:", cfg.Profile})
+		}
+		lines = append(lines, []string{"Base path:", cfg.StoragePath})
+		lines = append(lines, []string{"Namespaces:\n-", strings.Join(strings.Split(cfg.SecretPath, ","), "\n- ")})
+		lines = append(lines, []string{"Default Vault address:", cfg.EnvVaultAddr})
 		lines = append(lines, []string{"Default SSH username:", config.EnvSSHDefaultUsername})
 		lines = append(lines, []string{"SSH template username:", config.EnvSSHUsername})
-		lines = append(lines, []string{"SSH identity file:", config.EnvSSHIdentityFile})
+		lines = append(lines, []string{"SSH identity file:", cfg.EnvSSHIdentityFile})
 	}
 	return lines
 }
@@ -321,25 +776,45 @@ func getVersion() [][]string {
 func inspectItem(item string) {
 	switch item {
 	case "placeholders", "ph":
-		for k, v := range ssh.Placeholders {
-			if cfg.Verbose {
-				fmt.Printf("%v = %v\n", k, v)
-			} else {
-				fmt.Println(k)
+		printOutput(placeholderList(ssh.Placeholders), func(w io.Writer) {
+			for k, v := range ssh.Placeholders {
+				if cfg.Verbose {
+					fmt.Fprintf(w, "%v = %v\n", k, v)
+				} else {
+					fmt.Fprintln(w, k)
+				}
 			}
-		}
+		})
 	}
 }
 
 // printVersion of the application
 func printVersion() {
-	for _, line := range getVersion() {
-		fmt.Println(strings.Join(line, " "))
+	printOutput(getVersionInfo(), func(w io.Writer) {
+		for _, line := range getVersion() {
+			fmt.Fprintln(w, strings.Join(line, " "))
+		}
+	})
+}
+
+// cacheStatus displays the connections in the local cache
+func cacheStatus() bool {
+	log.Debug("cacheStatus")
+	currentCommand = "cache"
+
+	entries, err := getCacheEntries()
+	if err != nil {
+		log.Errorf("Unable to read the cache '%v': %v", cfg.StoragePath, err)
+		return false
 	}
+	return printOutput(entries, func(w io.Writer) {
+		writeTable(w, entries)
+	})
 }
 
 // updateSettings will update certain configuration items
-func updateSettings() {
+// cmd : the command being run
+func updateSettings(cmd *cobra.Command) {
 	if cfg.Debug {
 		cfg.LogLevel = logrus.DebugLevel
 	} else if cfg.Verbose {
@@ -347,10 +822,27 @@ func updateSettings() {
 	}
 	log.SetLevel(cfg.LogLevel)
 
+	// Apply the profile selected via the flags, keeping any settings
+	// that were also set using the flags
+	storagePath := cfg.StoragePath
+	if err := cfg.ApplyProfile(cfg.Profile); err != nil {
+		log.Fatalf("Unable to load the config from '%s': %v", cfg.ConfigFile, err)
+	}
+	if cmd.Flags().Changed("storage") {
+		cfg.StoragePath = storagePath
+	}
+	if !cmd.Flags().Changed("vault-addr") {
+		cfg.VaultAddr = cfg.EnvVaultAddr
+	}
+
 	if cfg.VaultToken == "" {
 		cfg.StoredToken = true
 	}
 
+	if !slices.Contains(outputFormats, cfg.Output) {
+		log.Fatalf("Invalid output format '%s', expected one of: %s", cfg.Output, strings.Join(outputFormats, ", "))
+	}
+
 	log.Debug("config: ", cfg.ToJSON())
 }
 
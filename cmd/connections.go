@@ -7,17 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"math"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
 	vaultApi "github.com/hashicorp/vault/api"
 
+	"github.com/cezmunsta/ssh_ms/config"
 	"github.com/cezmunsta/ssh_ms/log"
 	"github.com/cezmunsta/ssh_ms/ssh"
 	vaultHelper "github.com/cezmunsta/ssh_ms/vault"
@@ -35,10 +38,24 @@ const (
 	// CacheExpireAfter sets the threshold for cleaning stale caches
 	CacheExpireAfter = (7 * 24) * time.Hour
 
+	// LockExpireAfter sets the lifetime of a lock
+	LockExpireAfter = 10 * time.Minute
+
 	// LockPrefix is used to manage locking
 	LockPrefix = "ssh_ms_lock_"
+
+	// searchFieldAny is used to search all of the fields of a connection
+	searchFieldAny = "any"
+
+	// Orders used by list --sort
+	listSortHost      = "host"
+	listSortName      = "name"
+	listSortNameSpace = "namespace"
 )
 
+// listSortOrders are the values accepted by list --sort
+var listSortOrders = []string{listSortName, listSortHost, listSortNameSpace}
+
 // getVaultClient by authenticating using flags
 func getVaultClient() *vaultApi.Client {
 	env := vaultHelper.UserEnv{
@@ -68,6 +85,21 @@ func getLockPath(ln string) string {
 	return fmt.Sprintf("%s/%s", getSecretPath(), ln)
 }
 
+// getSecretKey produces the full path for a connection
+func getSecretKey(key string) string {
+	return fmt.Sprintf("%s/%s", getSecretPath(), key)
+}
+
+// getCurrentUser identifies the user making changes
+func getCurrentUser() string {
+	for _, u := range []string{os.Getenv(cfg.EnvSSHUsername), cfg.User, cfg.EnvSSHDefaultUsername} {
+		if u != "" {
+			return u
+		}
+	}
+	return "unknown"
+}
+
 // getSecretPath produces the secret path
 func getSecretPath() string {
 	sp := strings.Split(cfg.SecretPath, ",")
@@ -88,41 +120,168 @@ func getSecretPath() string {
 	return p
 }
 
-// acquireLock creates a lock to control writes
+// forEachNameSpace calls fn with cfg.NameSpace set to each of the available
+// namespaces in turn, or only the one requested via --namespace
+func forEachNameSpace(fn func(ns string)) {
+	selectedNameSpace := cfg.NameSpace
+	defer func() { cfg.NameSpace = selectedNameSpace }()
+
+	namespaces := strings.Split(cfg.SecretPath, ",")
+	if selectedNameSpace != "" {
+		namespaces = []string{selectedNameSpace}
+	}
+
+	for _, ns := range namespaces {
+		cfg.NameSpace = ns
+		fn(ns)
+	}
+}
+
+// matchNameSpace finds the namespace in cfg.SecretPath that matches either
+// the full path or its last element, e.g. secret/ssh_ms or ssh_ms
+// name : the namespace to find
+func matchNameSpace(name string) string {
+	for _, ns := range strings.Split(cfg.SecretPath, ",") {
+		if ns == name || path.Base(ns) == name {
+			return ns
+		}
+	}
+	return ""
+}
+
+// splitConnectionName separates the namespace from a connection, which can
+// be addressed as namespace:name or using the full path, e.g. secret/ssh_ms/name
+// key : the connection
+func splitConnectionName(key string) (string, string, error) {
+	if prefix, name, ok := strings.Cut(key, ":"); ok {
+		if ns := matchNameSpace(prefix); ns != "" && name != "" {
+			return ns, name, nil
+		}
+		return "", "", fmt.Errorf("unknown namespace '%s', expected one of: %s", prefix, cfg.SecretPath)
+	}
+
+	if i := strings.LastIndex(key, "/"); i > 0 {
+		if ns := key[:i]; slices.Contains(strings.Split(cfg.SecretPath, ","), ns) {
+			return ns, key[i+1:], nil
+		}
+		return "", "", fmt.Errorf("unknown namespace for '%s', expected one of: %s", key, cfg.SecretPath)
+	}
+	return "", key, nil
+}
+
+// qualifyConnectionName produces namespace:name for connections outside of
+// the default namespace
+// ns : the namespace
+// name : the connection
+func qualifyConnectionName(ns string, name string) string {
+	if ns == "" || ns == strings.Split(cfg.SecretPath, ",")[0] {
+		return name
+	}
+	return ns + ":" + name
+}
+
+// parseConnectionName selects the namespace when the connection is
+// qualified, returning the name of the connection
+// key : the connection
+func parseConnectionName(key string) (string, bool) {
+	ns, name, err := splitConnectionName(key)
+	if err != nil {
+		log.Error(err)
+		return "", false
+	}
+	if ns != "" {
+		cfg.NameSpace = ns
+	}
+	return name, true
+}
+
+// resolveConnection selects the namespace for a connection, either from the
+// qualified name or by finding the namespaces that contain it, asking the
+// user to choose when it exists in more than one. The local cache is used
+// first, only listing the namespaces when it is missing or ambiguous
+// vc : Vault client
+// key : the connection
+func resolveConnection(vc *vaultApi.Client, key string) (string, bool) {
+	log.Debugf("resolveConnection: %v", key)
+
+	ns, key, err := splitConnectionName(key)
+	if err != nil {
+		log.Error(err)
+		return "", false
+	} else if ns != "" {
+		cfg.NameSpace = ns
+		return key, true
+	} else if cfg.NameSpace != "" || !strings.Contains(cfg.SecretPath, ",") {
+		return key, true
+	}
+
+	var namespaces []string
+	forEachNameSpace(func(ns string) {
+		if data, _ := getCache(key); data != nil {
+			namespaces = append(namespaces, ns)
+		}
+	})
+
+	if len(namespaces) != 1 {
+		namespaces = nil
+		forEachNameSpace(func(ns string) {
+			if connections, err := getConnections(vc); err == nil && slices.Contains(connections, key) && lookupActiveConnection(vc, key) != nil {
+				namespaces = append(namespaces, ns)
+			}
+		})
+	}
+
+	switch len(namespaces) {
+	case 0:
+		return key, true
+	case 1:
+		cfg.NameSpace = namespaces[0]
+		return key, true
+	}
+
+	if !isTerminal() {
+		var names []string
+		for _, ns := range namespaces {
+			names = append(names, qualifyConnectionName(ns, key))
+		}
+		log.Errorf("'%v' exists in multiple namespaces, please use one of: %s", key, strings.Join(names, ", "))
+		return "", false
+	}
+
+	ns, ok := pickNameSpace(vc, key, namespaces)
+	if ok {
+		cfg.NameSpace = ns
+	}
+	return key, ok
+}
+
+// acquireLock creates a lock to control writes, automatically breaking
+// any existing lock that has passed its expiry time
 func acquireLock(vc *vaultApi.Client, key string) (bool, string) {
 	log.Debug("acquireLock: ", key)
 	loc, _ := time.LoadLocation("UTC")
 	ln := getLockName(key)
 
 	conn := make(secretData)
-	conn["User"] = os.Getenv(cfg.EnvSSHUsername)
-
-	// TODO: Auto-handle expired locks if necessary
-	/*
-		if existingLock, err := getRawConnection(vc, key); err != nil || existingLock != nil {
-			loc, _ := time.LoadLocation("UTC")
-			if val, ok := existingLock.Data["Expires"]; ok {
-				et, _ := time.ParseInLocation(time.RFC3339, fmt.Sprintf("%v", val), loc)
-				if time.Now().In(loc).After(et) {
-					vault.DeleteSecret()
-				} else {
-
-				}
-			} else {
-				log.Panicf("Unexpected situation, lock appears to be missing expiry date: ", existingLock.Data)
-			}
-		}
-	*/
+	conn["User"] = getCurrentUser()
 
 	if existingLock, err := getRawConnection(vc, ln); existingLock != nil {
-		log.Warningf("The record for '%v' appears to be locked: %v", key, existingLock)
 		if err != nil {
 			log.Fatal("existingLock error:", err)
 		}
-		return false, "nolock"
+
+		if expired, expires := lockExpired(existingLock); expired {
+			log.Warningf("Breaking expired lock for '%v' held by %v (expired %v)", key, existingLock["User"], expires)
+			if _, err := vaultHelper.DestroySecret(vc, getLockPath(ln)); err != nil {
+				log.Fatalf("Failed to break expired lock for '%v': %v", key, err)
+			}
+		} else {
+			log.Warningf("The record for '%v' is locked by %v until %v", key, existingLock["User"], expires)
+			return false, "nolock"
+		}
 	}
 
-	conn["Expires"] = time.Now().In(loc).Add(10 * time.Minute)
+	conn["Expires"] = time.Now().In(loc).Add(LockExpireAfter)
 
 	status, err := vaultHelper.WriteSecret(vc, getLockPath(ln), conn)
 	if err != nil {
@@ -132,6 +291,22 @@ func acquireLock(vc *vaultApi.Client, key string) (bool, string) {
 	return status, ln
 }
 
+// lockExpired checks whether a lock has passed its expiry time, a lock
+// without a valid expiry time is considered to have expired
+func lockExpired(lock map[string]interface{}) (bool, time.Time) {
+	val, ok := lock["Expires"]
+	if !ok {
+		return true, time.Time{}
+	}
+
+	expires, err := time.Parse(time.RFC3339, fmt.Sprintf("%v", val))
+	if err != nil {
+		log.Debugf("Unable to parse lock expiry '%v': %v", val, err)
+		return true, time.Time{}
+	}
+	return time.Now().After(expires), expires
+}
+
 // releaseLock will remove the acquired lock
 func releaseLock(vc *vaultApi.Client, ln string) (bool, error) {
 	log.Debug("releaseLock:", ln)
@@ -146,7 +321,7 @@ func releaseLock(vc *vaultApi.Client, ln string) (bool, error) {
 		return false, nil
 	}
 
-	status, err := vaultHelper.DeleteSecret(vc, getLockPath(ln))
+	status, err := vaultHelper.DestroySecret(vc, getLockPath(ln))
 	if err != nil {
 		log.Errorf("Failed to release lock for '%v': %v", ln, err)
 		return false, err
@@ -191,76 +366,330 @@ func getConnections(vc *vaultApi.Client) ([]string, error) {
 func listConnections(vc *vaultApi.Client) bool {
 	log.Debugf("listConnections")
 	currentCommand = "list"
+
+	if !slices.Contains(listSortOrders, listSort) {
+		log.Errorf("Unable to sort by '%s', expected one of: %s", listSort, strings.Join(listSortOrders, ", "))
+		return false
+	}
 	return searchConnections(vc, ".*")
 }
 
 // searchConnections filters the list of connections
 func searchConnections(vc *vaultApi.Client, pattern string) bool {
-	log.Debug("searchConnections: ", pattern)
+	log.Debug("searchConnections: ", pattern, searchField, tagFilters)
 	currentCommand = "search"
-	connections, err := getConnections(vc)
 	search := regexp.MustCompile(pattern)
 	ignore := regexp.MustCompile("^" + LockPrefix + ".*")
-	c := 0
+	entries := connectionList{}
+	found := false
+
+	filters, err := parseTagFilters(tagFilters)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
 
-	if connections == nil || err != nil {
+	field, err := getSearchField(searchField)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+
+	forEachNameSpace(func(ns string) {
+		connections, err := getConnections(vc)
+		if connections == nil || err != nil {
+			return
+		}
+		found = true
+
+		if len(filters) > 0 || field != "" {
+			// Uses the cached connections, only reading from Vault for those that are not cached
+			connections = matchConnections(vc, connections, func(data map[string]interface{}) bool {
+				return config.MatchTags(getTags(data), filters) && (field == "" || matchField(data, field, search))
+			})
+		}
+
+		for _, s := range connections {
+			if (pattern != ".*" && field == "" && !search.MatchString(s)) || ignore.MatchString(s) {
+				continue
+			}
+			entry := connectionEntry{Name: s, NameSpace: ns}
+			if listLong || listSort == listSortHost {
+				describeConnection(vc, &entry)
+			}
+			entries = append(entries, entry)
+		}
+	})
+
+	if !found {
 		fmt.Println("no available connections")
 		return false
 	}
 
-	for _, s := range connections {
-		m := " "
-		if (pattern != ".*" && !search.MatchString(s)) || ignore.MatchString(s) {
+	sortConnections(entries, listSort)
+
+	if listLong {
+		return printOutput(longConnectionList(entries), func(w io.Writer) {
+			writeColumns(w, longConnectionList(entries), getTerminalWidth())
+		})
+	}
+
+	return printOutput(entries, func(w io.Writer) {
+		for i, e := range entries {
+			m := " "
+			if math.Mod(float64(i+1), 3) == 0 {
+				m += "\n"
+			}
+			fmt.Fprint(w, e.Name, m)
+		}
+		fmt.Fprintln(w, "")
+	})
+}
+
+// describeConnection adds the details of a connection for list -l,
+// using the local cache where possible
+// vc : Vault client
+// entry : the connection to describe
+func describeConnection(vc *vaultApi.Client, entry *connectionEntry) {
+	data := lookupConnection(vc, entry.Name)
+	if data == nil {
+		return
+	}
+
+	value := func(key string, fallback string) string {
+		if v, ok := data[key]; ok && fmt.Sprintf("%v", v) != "" {
+			return fmt.Sprintf("%v", v)
+		}
+		return fallback
+	}
+
+	entry.HostName = value("HostName", "")
+	entry.Port = value("Port", "22")
+	entry.User = value("User", "")
+	entry.ProxyJump = value("ProxyJump", "")
+	entry.Comment = value("ConfigComment", "")
+}
+
+// sortConnections orders the connections by name, host or namespace,
+// followed by the name
+// entries : the connections to sort
+// by : the order
+func sortConnections(entries connectionList, by string) {
+	slices.SortStableFunc(entries, func(a, b connectionEntry) int {
+		c := 0
+		switch by {
+		case listSortHost:
+			c = strings.Compare(a.HostName, b.HostName)
+		case listSortNameSpace:
+			c = strings.Compare(a.NameSpace, b.NameSpace)
+		}
+		if c == 0 {
+			c = strings.Compare(a.Name, b.Name)
+		}
+		if c == 0 {
+			c = strings.Compare(a.NameSpace, b.NameSpace)
+		}
+		return c
+	})
+}
+
+// getSearchField normalises the field used by search, which is either
+// an option for a connection or any to match all options
+// name : the requested field
+func getSearchField(name string) (string, error) {
+	if name == "" || strings.EqualFold(name, searchFieldAny) {
+		return strings.ToLower(name), nil
+	}
+
+	kw, ok := config.LookupKeyword(name)
+	if !ok {
+		return "", fmt.Errorf("unknown field '%s', expected an option or '%s'", name, searchFieldAny)
+	}
+	return kw.Name, nil
+}
+
+// matchField checks whether the value of a field matches the pattern
+// data : the connection
+// field : the field to check, or any to check all of them
+// search : the pattern to match
+func matchField(data map[string]interface{}, field string, search *regexp.Regexp) bool {
+	for k, v := range data {
+		if (field == searchFieldAny || k == field) && search.MatchString(fmt.Sprintf("%v", v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTagFilters converts the tags used to select connections
+// specs : tags in the format key=value
+func parseTagFilters(specs []string) (map[string]string, error) {
+	filters := map[string]string{}
+
+	for _, spec := range specs {
+		key, value, err := config.ParseTag(spec)
+		if err != nil {
+			return nil, err
+		}
+		filters[key] = value
+	}
+	return filters, nil
+}
+
+// getTags returns the tags for a connection
+// data : the connection
+func getTags(data map[string]interface{}) map[string]string {
+	spec, ok := data["Tags"]
+	if !ok {
+		return map[string]string{}
+	}
+
+	tags, err := config.ParseTags(fmt.Sprintf("%v", spec))
+	if err != nil {
+		log.Warningf("Ignoring invalid tags '%v': %v", spec, err)
+		return map[string]string{}
+	}
+	return tags
+}
+
+// applyTags adds tags to a connection, with an empty value removing the tag
+// conn : the connection
+// specs : tags in the format key=value
+func applyTags(conn secretData, specs []string) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	tags := getTags(conn)
+	for _, spec := range specs {
+		key, value, err := config.ParseTag(spec)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			delete(tags, key)
 			continue
 		}
-		c++
-		if math.Mod(float64(c), 3) == 0 && c > 0 {
-			m += "\n"
+		tags[key] = value
+	}
+
+	if len(tags) == 0 {
+		delete(conn, "Tags")
+	} else {
+		conn["Tags"] = config.FormatTags(tags)
+	}
+	return nil
+}
+
+// filterTaggedConnections returns the connections in the current namespace
+// that have all of the requested tags
+// vc : Vault client
+// connections : the connections to check
+// filters : the tags that must match
+func filterTaggedConnections(vc *vaultApi.Client, connections []string, filters map[string]string) []string {
+	return matchConnections(vc, connections, func(data map[string]interface{}) bool {
+		return config.MatchTags(getTags(data), filters)
+	})
+}
+
+// matchConnections returns the connections in the current namespace that
+// are accepted by fn, using the local cache where possible
+// vc : Vault client
+// connections : the connections to check
+// fn : called with the details of each connection
+func matchConnections(vc *vaultApi.Client, connections []string, fn func(data map[string]interface{}) bool) []string {
+	var matched []string
+
+	for _, key := range connections {
+		if strings.HasPrefix(key, LockPrefix) {
+			continue
+		}
+		if data := lookupActiveConnection(vc, key); data != nil && fn(data) {
+			matched = append(matched, key)
 		}
-		fmt.Print(s, m)
 	}
-	fmt.Println("")
-	return true
+	return matched
 }
 
 // showConnection details suitable for use with ssh_config
 func showConnection(vc *vaultApi.Client, key string) bool {
 	log.Debugf("showConnection: %v", key)
 	currentCommand = "show"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
 	sshArgs, sshClient, configComment, _ := prepareConnection(vc, []string{key})
 
 	log.Info("SSH cmd:", sshArgs)
-	if len(configComment) > 0 {
-		fmt.Println("#", configComment)
-	} else {
-		fmt.Println("#", key)
-	}
-	fmt.Println(sshClient.Cache.Config)
-	return true
+	return printOutput(newConnectionDetails(key, configComment, sshClient), func(w io.Writer) {
+		if len(configComment) > 0 {
+			fmt.Fprintln(w, "#", configComment)
+		} else {
+			fmt.Fprintln(w, "#", key)
+		}
+		fmt.Fprintln(w, sshClient.Cache.Config)
+	})
 }
 
 // printConnection details suitable for use on the command line
 func printConnection(vc *vaultApi.Client, key string) bool {
 	log.Debugf("printConnection: %v", key)
 	currentCommand = "print"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
 	sshArgs, _, _, _ := prepareConnection(vc, []string{key})
 
-	fmt.Printf("ssh %v\n", strings.Join(sshArgs, " "))
-	return true
+	return printOutput(connectionCommand{Name: key, Command: append([]string{"ssh"}, sshArgs...)}, func(w io.Writer) {
+		fmt.Fprintf(w, "ssh %v\n", strings.Join(sshArgs, " "))
+	})
+}
+
+// parseOptions validates options in the format Keyword=Value against
+// the catalogue of keywords, adding them to the connection
+// conn : the connection to update
+// args : the options to add
+func parseOptions(conn secretData, args []string) error {
+	for _, arg := range args {
+		s := strings.SplitN(arg, "=", 2)
+		if len(s) != 2 {
+			log.Fatalf("Unexpected option '%v', expected XXX=YYY", arg)
+		}
+
+		kw, ok := config.LookupKeyword(s[0])
+		if !ok {
+			return fmt.Errorf("unknown option: %s", s[0])
+		}
+		if err := kw.Validate(s[1]); err != nil {
+			return err
+		}
+		conn[kw.Name] = s[1]
+	}
+	return nil
 }
 
 // writeConnection creates a new entry, or updates an existing one
 func writeConnection(vc *vaultApi.Client, key string, args []string) bool {
 	log.Debugf("writeConnection: %v", key)
 	currentCommand = "write"
+	key, ok := parseConnectionName(key)
+	if !ok {
+		return false
+	}
 	_, err := getRawConnection(vc, key)
 	conn := make(secretData)
 
 	if err != nil {
 		// New connection
-		for i := 0; i < len(args); i++ {
-			s := strings.Split(args[i], "=")
-			conn[s[0]] = s[1]
+		if err := parseOptions(conn, args); err != nil {
+			log.Errorf("Unable to write '%v': %v", key, err)
+			return false
+		}
+		if err := applyTags(conn, connectionTags); err != nil {
+			log.Errorf("Unable to write '%v': %v", key, err)
+			return false
 		}
 	} else {
 		// Existing connection
@@ -270,20 +699,15 @@ func writeConnection(vc *vaultApi.Client, key string, args []string) bool {
 
 	conn["ConfigComment"] = cfg.ConfigComment
 	conn["ConfigMotd"] = cfg.ConfigMotd
+	conn["ModifiedBy"] = getCurrentUser()
 
 	if cfg.Simulate {
 		log.Infof("simulated write to '%v': %v", key, args)
 		return true
 	}
 
-	if status, lockName := acquireLock(vc, key); status && lockName != "nolock" {
-		defer releaseLock(vc, lockName)
-	} else {
-		log.Fatal("Failed to acquire lock for writeConnection")
-		return false
-	}
-
-	status, err := vaultHelper.WriteSecret(vc, fmt.Sprintf("%s/%s", getSecretPath(), key), conn)
+	version := getReplaceableVersion(vc, key)
+	status, err := storeConnection(vc, key, conn, version)
 	if err != nil {
 		log.Errorf("Failed to write '%v': %v", key, err)
 		return false
@@ -296,18 +720,23 @@ func writeConnection(vc *vaultApi.Client, key string, args []string) bool {
 func updateConnection(vc *vaultApi.Client, key string, args []string) bool {
 	log.Debugf("updateConnection: %v", key)
 	currentCommand = "update"
-	conn, err := getRawConnection(vc, key)
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+	conn, version, err := getRawConnectionVersioned(vc, key)
 	if err != nil {
 		log.Warningf("Unable to retrieve connection '%v', please use write instead", key)
 		return false
 	}
 
-	for i := 0; i < len(args); i++ {
-		s := strings.Split(args[i], "=")
-		if len(s) != 2 {
-			log.Fatalf("Unexpected option '%v', expected XXX=YYY", args[i])
-		}
-		conn[s[0]] = s[1]
+	if err := parseOptions(conn, args); err != nil {
+		log.Errorf("Unable to update '%v': %v", key, err)
+		return false
+	}
+	if err := applyTags(conn, connectionTags); err != nil {
+		log.Errorf("Unable to update '%v': %v", key, err)
+		return false
 	}
 
 	if len(cfg.ConfigComment) > 0 {
@@ -317,21 +746,14 @@ func updateConnection(vc *vaultApi.Client, key string, args []string) bool {
 	if len(cfg.ConfigMotd) > 0 {
 		conn["ConfigMotd"] = cfg.ConfigMotd
 	}
+	conn["ModifiedBy"] = getCurrentUser()
 
 	if cfg.Simulate {
 		log.Infof("Simulate update of '%v': %v", key, conn)
 		return true
 	}
 
-	if status, lockName := acquireLock(vc, key); status && lockName != "nolock" {
-		defer releaseLock(vc, lockName)
-	} else {
-		log.Debugf("status: %v, lockName: %v", status, lockName)
-		log.Fatal("Failed to acquire lock for updateConnection")
-		return false
-	}
-
-	status, err := vaultHelper.WriteSecret(vc, fmt.Sprintf("%s/%s", getSecretPath(), key), conn)
+	status, err := storeConnection(vc, key, conn, version)
 	if err != nil {
 		log.Errorf("Failed to write '%v': %v", key, err)
 		return false
@@ -340,42 +762,104 @@ func updateConnection(vc *vaultApi.Client, key string, args []string) bool {
 	return status
 }
 
+// getReplaceableVersion returns the check-and-set version for writing a new
+// connection, which is only allowed to replace a deleted version, otherwise
+// the record must not exist
+func getReplaceableVersion(vc *vaultApi.Client, key string) int {
+	if current, deleted, err := vaultHelper.GetCurrentVersion(vc, getSecretKey(key)); err == nil && deleted {
+		return current
+	}
+	return 0
+}
+
+// storeConnection writes an entry to Vault, using check-and-set on KV v2
+// mounts and falling back to a lock record on KV v1 mounts
+// version : the version that was read, or 0 for a new connection
+func storeConnection(vc *vaultApi.Client, key string, conn secretData, version int) (bool, error) {
+	log.Debugf("storeConnection: %v (version %d)", key, version)
+	path := getSecretKey(key)
+
+	if vaultHelper.IsVersioned(vc, path) {
+		return vaultHelper.WriteSecretCAS(vc, path, conn, version)
+	}
+
+	if status, lockName := acquireLock(vc, key); status && lockName != "nolock" {
+		defer releaseLock(vc, lockName)
+	} else {
+		log.Debugf("status: %v, lockName: %v", status, lockName)
+		log.Fatalf("Failed to acquire lock for %s", currentCommand)
+		return false, nil
+	}
+	return vaultHelper.WriteSecret(vc, path, conn)
+}
+
 // deleteConnection removes an entry from Vault
-func deleteConnection(vc *vaultApi.Client, key string) bool {
+// purge : permanently remove all versions, rather than only the latest
+func deleteConnection(vc *vaultApi.Client, key string, purge bool) bool {
 	log.Debugf("deleteConnection: %v", key)
 	currentCommand = "delete"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
 	_, err := getRawConnection(vc, key)
-	if err != nil {
+	if err != nil && !purge {
 		log.Debug("Unable to retrieve connection", key)
 		return false
 	}
 	if cfg.Simulate {
-		log.Infof("simulated delete of '%v'", key)
+		log.Infof("simulated delete of '%v' (purge: %v)", key, purge)
 		return true
 	}
 
-	if status, lockName := acquireLock(vc, key); status && lockName != "nolock" {
+	if vaultHelper.IsVersioned(vc, getSecretKey(key)) {
+		log.Debug("Skipping lock for KV v2 delete")
+	} else if status, lockName := acquireLock(vc, key); status && lockName != "nolock" {
 		defer releaseLock(vc, lockName)
 	} else {
 		log.Fatal("Failed to acquire lock for deleteConnection")
 		return false
 	}
 
-	status, err := vaultHelper.DeleteSecret(vc, fmt.Sprintf("%s/%s", getSecretPath(), key))
+	deleteSecret := vaultHelper.DeleteSecret
+	if purge {
+		deleteSecret = vaultHelper.DestroySecret
+	}
+
+	status, err := deleteSecret(vc, getSecretKey(key))
 	if err != nil {
 		log.Warning("Unable to delete connection", key)
 		return false
 	}
+	removeCache(key)
 	return status
 }
 
-func findKeyByValue(m map[string]string, value string) (string, bool) {
-	for k, v := range m {
-		if v == value {
-			return k, true
-		}
+// undeleteConnection restores the latest deleted version of an entry
+func undeleteConnection(vc *vaultApi.Client, key string) bool {
+	log.Debugf("undeleteConnection: %v", key)
+	currentCommand = "undelete"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
 	}
-	return "", false
+
+	if cfg.Simulate {
+		log.Infof("simulated undelete of '%v'", key)
+		return true
+	}
+
+	version, err := vaultHelper.UndeleteSecret(vc, getSecretKey(key))
+	if err != nil {
+		log.Errorf("Unable to undelete '%v': %v", key, err)
+		return false
+	}
+
+	if conn, err := getRawConnection(vc, key); err == nil {
+		saveCache(key, conn)
+	}
+	fmt.Printf("Restored version %d of %s\n", version, key)
+	return true
 }
 
 // prepareConnection for SSH
@@ -385,44 +869,52 @@ func findKeyByValue(m map[string]string, value string) (string, bool) {
 func prepareConnection(vc *vaultApi.Client, args []string) ([]string, ssh.Connection, string, string) {
 	log.Debugf("prepareConnection: %v", args)
 	var sshArgs []string
-	var svc string
 	var configComment string
 	var configMotd string
 
 	if len(args) == 0 {
 		log.Fatal("Minimum requirement is to specify an alias")
 	}
-	key := args[0]
-	config := lookupConnection(vc, key)
+	key, ok := resolveConnection(vc, args[0])
+	if !ok {
+		os.Exit(1)
+	}
+	data := lookupConnection(vc, key)
 	configComment = key
 	configMotd = ""
 
-	if val, ok := config["ConfigComment"]; ok {
+	if val, ok := data["ConfigComment"]; ok {
 		log.Debugf("Found comment for '%v': %v", key, val)
 		configComment = fmt.Sprintf("%v", val)
 	}
 
-	if val, ok := config["ConfigMotd"]; ok {
+	if val, ok := data["ConfigMotd"]; ok {
 		log.Debugf("Found Motd for '%v': %v", key, val)
 		configMotd = fmt.Sprintf("%v\n", val)
 	}
 
-	if config == nil {
+	if data == nil {
 		return sshArgs, ssh.Connection{}, key, configMotd
 	}
 
-	log.Debugf("config: %v", config)
-	sshClient := ssh.Connection{}
-	sshArgs = append(sshClient.BuildConnection(config, key, cfg.User), args[1:]...)
+	log.Debugf("config: %v", data)
+	sshClient := ssh.Connection{Lookup: jumpHostLookup(vc)}
+	builtArgs, err := sshClient.BuildConnection(data, key, cfg.User)
+	if err != nil {
+		log.Fatalf("Unable to prepare '%v': %v", key, err)
+	}
+	sshArgs = append(builtArgs, args[1:]...)
 	log.Debugf("sshArgs: %v", sshArgs)
 
-	for i := 0; i < len(sshClient.LocalForward); i++ {
-		if svcName, ok := findKeyByValue(cfg.ServiceMap, strconv.FormatUint(uint64(sshClient.LocalForward[i].RemotePort), 10)); ok {
-			svc = svcName
-		} else {
-			svc = "Custom forwarding"
+	for _, lf := range sshClient.LocalForward {
+		configMotd += "\n" + formatForward(lf)
+	}
+
+	if sshClient.DynamicForward > 0 {
+		configMotd += fmt.Sprintf("\nSOCKS: socks5://127.0.0.1:%d", sshClient.DynamicForward)
+		if cfg.PacFile != "" {
+			configMotd += fmt.Sprintf("\nPAC: file://%s", getPacFilePath())
 		}
-		configMotd += fmt.Sprintf("\nFWD: https://127.0.0.1:%d - %s (%d)", sshClient.LocalForward[i].LocalPort, svc, sshClient.LocalForward[i].RemotePort)
 	}
 
 	if configAutoMotdTpl, err := template.New("configAutoMotd").Parse(`
@@ -444,6 +936,61 @@ Server connection: {{.Name}}
 	return sshArgs, sshClient, configComment, configMotd
 }
 
+// renderConnection resolves the options for a connection without allocating
+// ports for forwards, returning any error rather than exiting
+// vc : Vault client
+// key : the connection in the current namespace
+func renderConnection(vc *vaultApi.Client, key string) (ssh.Connection, error) {
+	log.Debugf("renderConnection: %v", key)
+	sshClient := ssh.Connection{Lookup: jumpHostLookup(vc)}
+
+	data := lookupConnection(vc, key)
+	if data == nil {
+		return sshClient, fmt.Errorf("unable to find connection")
+	}
+	err := sshClient.RenderConnection(data, key, cfg.User)
+	return sshClient, err
+}
+
+// formatForward describes a LocalForward for display
+// lf : the forward to describe
+func formatForward(lf ssh.LocalForward) string {
+	svc := lf.Name
+	if svc == "" {
+		svc = "Custom forwarding"
+	}
+	target := fmt.Sprintf("%d", lf.RemotePort)
+	if lf.BindHost != config.DefaultServiceBindHost {
+		target = fmt.Sprintf("%s:%d", lf.BindHost, lf.RemotePort)
+	}
+	return fmt.Sprintf("FWD: %s - %s (%s)", lf.URL(), svc, target)
+}
+
+// jumpHostLookup resolves ProxyJump hosts using the local cache and then
+// remote, without reporting hosts that are not stored connections. The
+// namespace of the connection is searched first, followed by the others
+// vc : Vault client
+func jumpHostLookup(vc *vaultApi.Client) ssh.ConnectionLookup {
+	return func(key string) map[string]interface{} {
+		current := cfg.NameSpace
+		defer func() { cfg.NameSpace = current }()
+
+		namespaces := strings.Split(cfg.SecretPath, ",")
+		if i := slices.Index(namespaces, current); i > 0 {
+			namespaces = append([]string{current}, slices.Delete(namespaces, i, i+1)...)
+		}
+
+		for _, ns := range namespaces {
+			cfg.NameSpace = ns
+			if data := lookupActiveConnection(vc, key); data != nil {
+				return data
+			}
+		}
+		log.Debugf("No stored connection for jump host '%v'", key)
+		return nil
+	}
+}
+
 // lookupConnection tries local cache and then remote to acquire connection details
 func lookupConnection(vc *vaultApi.Client, key string) map[string]interface{} {
 	log.Debug("lookupConnection: ", key)
@@ -456,6 +1003,26 @@ func lookupConnection(vc *vaultApi.Client, key string) map[string]interface{} {
 	return config
 }
 
+// lookupActiveConnection tries local cache and then remote, without
+// reporting connections that are listed but have been deleted
+func lookupActiveConnection(vc *vaultApi.Client, key string) map[string]interface{} {
+	log.Debug("lookupActiveConnection: ", key)
+	if config, _ := getCache(key); config != nil {
+		return config
+	}
+
+	config, err := vaultHelper.ReadSecret(vc, getSecretKey(key))
+	if err != nil {
+		log.Debugf("Skipping '%v': %v", key, err)
+		return nil
+	}
+
+	if status, err := saveCache(key, config); err != nil || !status {
+		return nil
+	}
+	return config
+}
+
 // connect using SSH
 // vc: Vault client
 // env: UserEnv configuration
@@ -463,7 +1030,7 @@ func lookupConnection(vc *vaultApi.Client, key string) map[string]interface{} {
 func connect(vc *vaultApi.Client, env ssh.UserEnv, args []string) {
 	log.Debug("connect:", args[0])
 	currentCommand = "connect"
-	sshArgs, _, _, configMotd := prepareConnection(vc, args)
+	sshArgs, sshClient, _, configMotd := prepareConnection(vc, args)
 
 	log.Debugf("%v", map[string]interface{}{
 		"env":  env,
@@ -475,14 +1042,82 @@ func connect(vc *vaultApi.Client, env ssh.UserEnv, args []string) {
 		return
 	}
 
+	if cfg.PacFile != "" {
+		writePacFile(sshClient)
+	}
+
 	fmt.Println(configMotd)
 	ssh.Connect(sshArgs, env)
 }
 
+// getPacFilePath returns the absolute path for the PAC file
+func getPacFilePath() string {
+	path, err := filepath.Abs(config.NormalizePath(cfg.PacFile))
+	if err != nil {
+		return cfg.PacFile
+	}
+	return path
+}
+
+// writePacFile creates a proxy auto-config file for the SOCKS proxy
+// sshClient : the prepared connection
+func writePacFile(sshClient ssh.Connection) bool {
+	log.Debugf("writePacFile: %v", cfg.PacFile)
+	pac, err := sshClient.PAC()
+	if err != nil {
+		log.Warningf("Unable to generate PAC file: %v", err)
+		return false
+	}
+
+	if err := os.WriteFile(getPacFilePath(), []byte(pac), 0o644); err != nil {
+		log.Errorf("Failed to write PAC file '%v': %v", cfg.PacFile, err)
+		return false
+	}
+	return true
+}
+
 // getCachePath returns the path to save to
 func getCachePath(key string) string {
 	log.Debugf("getCachePath: %v", key)
-	return filepath.Join(cfg.StoragePath, key+".json")
+	return filepath.Join(getCacheDir(cfg.NameSpace), key+".json")
+}
+
+// getCacheDir returns the cache directory for a namespace, which is the
+// top level for the default namespace and a subdirectory for the others,
+// so that connections with the same name do not overwrite each other
+// ns : the namespace
+func getCacheDir(ns string) string {
+	namespaces := strings.Split(cfg.SecretPath, ",")
+	if ns == "" || ns == namespaces[0] || !slices.Contains(namespaces, ns) {
+		return cfg.StoragePath
+	}
+	return filepath.Join(cfg.StoragePath, ns)
+}
+
+// cacheFile is a connection in the local cache
+type cacheFile struct {
+	Path, Name, NameSpace string
+}
+
+// getCacheFiles lists the connections in the local cache for each namespace,
+// excluding the forwards that are tracked alongside them for each ControlPath
+func getCacheFiles() ([]cacheFile, error) {
+	var files []cacheFile
+
+	for _, ns := range strings.Split(cfg.SecretPath, ",") {
+		matches, err := filepath.Glob(filepath.Join(getCacheDir(ns), "*.json"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range matches {
+			if ssh.IsForwardCache(f) {
+				continue
+			}
+			files = append(files, cacheFile{Path: f, Name: strings.TrimSuffix(filepath.Base(f), ".json"), NameSpace: ns})
+		}
+	}
+	return files, nil
 }
 
 // makeCachePath manages the creation of the cfg.StoragePath
@@ -617,7 +1252,11 @@ func purgeCache() (bool, error) {
 
 	if targeted {
 		log.Debug("Purging individual connection:", purgeConnection)
-		return removeCache(purgeConnection)
+		key, ok := parseConnectionName(purgeConnection)
+		if !ok {
+			return false, fmt.Errorf("unable to purge '%s'", purgeConnection)
+		}
+		return removeCache(key)
 	} else if err := os.RemoveAll(cfg.StoragePath); err != nil {
 		log.Errorf("Problem purging cache: %v", err)
 		return false, err
@@ -632,8 +1271,8 @@ func saveCache(key string, data map[string]interface{}) (bool, error) {
 	log.Debugf("saveCache: %v", key)
 	makeCachePath()
 
-	if err := os.MkdirAll(cfg.StoragePath, os.ModePerm); err != nil {
-		log.Errorf("Failed to create cache directory '%v': %v", cfg.StoragePath, err)
+	if err := os.MkdirAll(filepath.Dir(getCachePath(key)), os.ModePerm); err != nil {
+		log.Errorf("Failed to create cache directory '%v': %v", filepath.Dir(getCachePath(key)), err)
 		return false, err
 	}
 
@@ -652,14 +1291,21 @@ func saveCache(key string, data map[string]interface{}) (bool, error) {
 
 // getRawConnection retrieves the secret from Vault
 func getRawConnection(vc *vaultApi.Client, key string) (map[string]interface{}, error) {
-	secret, err := vaultHelper.ReadSecret(vc, fmt.Sprintf("%s/%s", getSecretPath(), key))
+	secret, _, err := getRawConnectionVersioned(vc, key)
+	return secret, err
+}
+
+// getRawConnectionVersioned retrieves the secret from Vault along with
+// its version, which is always 0 for KV v1 mounts
+func getRawConnectionVersioned(vc *vaultApi.Client, key string) (map[string]interface{}, int, error) {
+	secret, version, err := vaultHelper.ReadSecretVersioned(vc, getSecretKey(key))
 
 	if err != nil || secret == nil {
 		if !strings.HasPrefix(key, LockPrefix) && currentCommand != "write" {
 			log.Warning("Unable to find connection for: ", key)
-			return nil, errors.New("no match found")
+			return nil, 0, errors.New("no match found")
 		}
-		return nil, errors.New("no lock found")
+		return nil, 0, errors.New("no lock found")
 	}
-	return secret, nil
+	return secret, version, nil
 }
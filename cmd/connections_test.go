@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cezmunsta/ssh_ms/config"
+	"github.com/cezmunsta/ssh_ms/helpers"
 	"github.com/cezmunsta/ssh_ms/ssh"
 )
 
@@ -151,3 +154,221 @@ func TestPrepareConnection(t *testing.T) {
 		t.Fatalf("expected motd to contain '%v', got '%v'", dummyMotd, configMotd)
 	}
 }
+
+func TestDiffSecretData(t *testing.T) {
+	from := map[string]interface{}{"HostName": "10.0.0.1", "Port": "22", "User": "bob"}
+	to := map[string]interface{}{"HostName": "10.0.0.2", "Port": "22", "ProxyJump": "gateway"}
+	expected := []string{
+		"- HostName=10.0.0.1",
+		"+ HostName=10.0.0.2",
+		"+ ProxyJump=gateway",
+		"- User=bob",
+	}
+
+	if lines := diffSecretData(from, to); strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected: %v, got: %v", expected, lines)
+	}
+
+	if lines := diffSecretData(from, from); len(lines) != 0 {
+		t.Fatalf("expected: no changes, got: %v", lines)
+	}
+}
+
+func TestRollbackConnection(t *testing.T) {
+	_, client := getDummyCluster(t)
+	secretPath, nameSpace := cfg.SecretPath, cfg.NameSpace
+	defer func() { cfg.SecretPath, cfg.NameSpace = secretPath, nameSpace }()
+	cfg.SecretPath, cfg.NameSpace = helpers.GetVaultSecretPaths()[1], ""
+
+	for i, conn := range []secretData{
+		{"HostName": "10.0.0.1", "ModifiedBy": "someone-else"},
+		{"HostName": "10.0.0.2", "Tags": "env=prod"},
+	} {
+		if _, err := storeConnection(client, "rollback", conn, i); err != nil {
+			t.Fatalf("expected: version %d to be written, got: %v", i+1, err)
+		}
+	}
+
+	if !rollbackConnection(client, "rollback", 1) {
+		t.Fatal("expected: version 1 to be restored")
+	}
+	conn, version, err := getRawConnectionVersioned(client, "rollback")
+	if err != nil || version != 3 || conn["HostName"] != "10.0.0.1" {
+		t.Fatalf("expected: version 1 restored as version 3, got: %v (%v), %v", conn, version, err)
+	}
+	if conn["ModifiedBy"] != getCurrentUser() || conn["Tags"] != "env=prod" {
+		t.Fatalf("expected: the current user and tags, got: %v", conn)
+	}
+
+	if rollbackConnection(client, "rollback", 3) {
+		t.Fatal("expected: the latest version to be rejected")
+	}
+}
+
+func TestLockExpired(t *testing.T) {
+	future := time.Now().Add(LockExpireAfter)
+	past := time.Now().Add(-time.Minute)
+
+	if expired, expires := lockExpired(map[string]interface{}{"Expires": future.Format(time.RFC3339Nano)}); expired || !expires.Equal(future) {
+		t.Fatalf("expected: an active lock expiring at %v, got: %v, %v", future, expired, expires)
+	}
+
+	if expired, _ := lockExpired(map[string]interface{}{"Expires": past.Format(time.RFC3339)}); !expired {
+		t.Fatal("expected: an expired lock")
+	}
+
+	for _, lock := range []map[string]interface{}{{}, {"Expires": "soon"}} {
+		if expired, _ := lockExpired(lock); !expired {
+			t.Fatalf("expected: %v to be treated as expired", lock)
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	conn := make(secretData)
+	if err := parseOptions(conn, []string{"hostname=10.0.0.1", "connecttimeout=10", "SetEnv=TERM=xterm"}); err != nil {
+		t.Fatalf("expected: valid options, got: %v", err)
+	}
+	if conn["HostName"] != "10.0.0.1" || conn["ConnectTimeout"] != "10" || conn["SetEnv"] != "TERM=xterm" {
+		t.Fatalf("expected: normalised options, got: %v", conn)
+	}
+
+	for _, arg := range []string{"UseRoaming=no", "RequestTTY=sometimes"} {
+		if err := parseOptions(make(secretData), []string{arg}); err == nil {
+			t.Fatalf("expected: an error for %v", arg)
+		}
+	}
+}
+
+func TestApplyTags(t *testing.T) {
+	conn := secretData{"HostName": "10.0.0.1", "Tags": "env=dev,role=db"}
+	if err := applyTags(conn, []string{"env=prod", "customer=acme", "role="}); err != nil {
+		t.Fatalf("expected: valid tags, got: %v", err)
+	}
+	if conn["Tags"] != "customer=acme,env=prod" {
+		t.Fatalf("expected: customer=acme,env=prod got: %v", conn["Tags"])
+	}
+
+	if err := applyTags(conn, []string{"customer=", "env="}); err != nil || conn["Tags"] != nil {
+		t.Fatalf("expected: tags to be removed, got: %v (%v)", conn["Tags"], err)
+	}
+	if err := applyTags(conn, []string{"env"}); err == nil {
+		t.Fatal("expected: an error for a tag without a value")
+	}
+
+	if _, err := parseTagFilters([]string{"env=prod", "customer"}); err == nil {
+		t.Fatal("expected: an error for an invalid filter")
+	}
+}
+
+func TestSearchField(t *testing.T) {
+	for name, expected := range map[string]string{"": "", "hostname": "HostName", "ANY": searchFieldAny, "configcomment": "ConfigComment"} {
+		if field, err := getSearchField(name); err != nil || field != expected {
+			t.Fatalf("expected: %v got: %v (%v)", expected, field, err)
+		}
+	}
+	if _, err := getSearchField("Address"); err == nil {
+		t.Fatal("expected: an error for an unknown field")
+	}
+
+	data := map[string]interface{}{"HostName": "10.2.3.4", "User": "bob", "ConfigComment": "Acme primary"}
+	for _, tc := range []struct {
+		field, pattern string
+		expected       bool
+	}{
+		{"HostName", `^10\.2\.3\.4$`, true},
+		{"User", `^10\.2`, false},
+		{"ProxyJump", ".*", false},
+		{searchFieldAny, "(?i)acme", true},
+		{searchFieldAny, "nomatch", false},
+	} {
+		if m := matchField(data, tc.field, regexp.MustCompile(tc.pattern)); m != tc.expected {
+			t.Fatalf("expected: %v for %v %v got: %v", tc.expected, tc.field, tc.pattern, m)
+		}
+	}
+}
+
+func TestSortConnections(t *testing.T) {
+	entries := connectionList{
+		{Name: "web1", NameSpace: "secret/a", HostName: "10.0.0.1"},
+		{Name: "db1", NameSpace: "secret/b", HostName: "10.0.0.9"},
+		{Name: "db1", NameSpace: "secret/a", HostName: "10.0.0.5"},
+	}
+
+	for by, expected := range map[string][]string{
+		listSortName:      {"db1 secret/a", "db1 secret/b", "web1 secret/a"},
+		listSortHost:      {"web1 secret/a", "db1 secret/a", "db1 secret/b"},
+		listSortNameSpace: {"db1 secret/a", "web1 secret/a", "db1 secret/b"},
+	} {
+		sortConnections(entries, by)
+		for i, e := range entries {
+			if e.Name+" "+e.NameSpace != expected[i] {
+				t.Fatalf("expected: %v when sorting by %v got: %v", expected, by, entries)
+			}
+		}
+	}
+}
+
+func TestSplitConnectionName(t *testing.T) {
+	secretPath := cfg.SecretPath
+	defer func() { cfg.SecretPath = secretPath }()
+	cfg.SecretPath = "secret/ssh_ms,secret/other"
+
+	for key, expected := range map[string][]string{
+		"gateway":                {"", "gateway"},
+		"other:gateway":          {"secret/other", "gateway"},
+		"secret/other:gateway":   {"secret/other", "gateway"},
+		"secret/other/gateway":   {"secret/other", "gateway"},
+		"ssh_ms:gateway":         {"secret/ssh_ms", "gateway"},
+		"missing:gateway":        nil,
+		"secret/missing/gateway": nil,
+		"other:":                 nil,
+	} {
+		ns, name, err := splitConnectionName(key)
+		if expected == nil {
+			if err == nil {
+				t.Fatalf("expected: an error for %v got: %v, %v", key, ns, name)
+			}
+			continue
+		}
+		if err != nil || ns != expected[0] || name != expected[1] {
+			t.Fatalf("expected: %v for %v got: %v, %v (%v)", expected, key, ns, name, err)
+		}
+	}
+
+	if name := qualifyConnectionName("secret/ssh_ms", "gateway"); name != "gateway" {
+		t.Fatalf("expected: gateway got: %v", name)
+	}
+	if name := qualifyConnectionName("secret/other", "gateway"); name != "secret/other:gateway" {
+		t.Fatalf("expected: secret/other:gateway got: %v", name)
+	}
+
+	if dir := getCacheDir("secret/ssh_ms"); dir != cfg.StoragePath {
+		t.Fatalf("expected: %v got: %v", cfg.StoragePath, dir)
+	}
+	if dir := getCacheDir("secret/other"); dir != filepath.Join(cfg.StoragePath, "secret/other") {
+		t.Fatalf("expected: a subdirectory for the namespace got: %v", dir)
+	}
+}
+
+func TestResolveConnection(t *testing.T) {
+	secretPath, storagePath, nameSpace := cfg.SecretPath, cfg.StoragePath, cfg.NameSpace
+	defer func() { cfg.SecretPath, cfg.StoragePath, cfg.NameSpace = secretPath, storagePath, nameSpace }()
+	cfg.SecretPath = "secret/ssh_ms,secret/other"
+	cfg.StoragePath = t.TempDir()
+	cfg.NameSpace = "secret/other"
+	saveCache("resolve-db", map[string]interface{}{"HostName": "10.0.0.1"})
+
+	// A connection cached in one namespace does not need to be listed
+	cfg.NameSpace = ""
+	if key, ok := resolveConnection(nil, "resolve-db"); !ok || key != "resolve-db" || cfg.NameSpace != "secret/other" {
+		t.Fatalf("expected: resolve-db in secret/other, got: %v, %v in %v", key, ok, cfg.NameSpace)
+	}
+
+	for _, path := range []string{"secret/ssh_ms", "secret/ssh_ms,secret/other"} {
+		cfg.SecretPath, cfg.NameSpace = path, ""
+		if key, ok := resolveConnection(nil, "missing:resolve-db"); ok {
+			t.Fatalf("expected: an unknown namespace to be rejected with %v, got: %v", path, key)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+// getControlPath returns the ControlPath for a connection
+// vc : Vault client
+// key : the connection
+func getControlPath(vc *vaultApi.Client, key string) (string, bool) {
+	data := lookupConnection(vc, key)
+	if data == nil {
+		log.Errorf("Unable to find connection '%v'", key)
+		return "", false
+	}
+	return ssh.GetControlPath(data, cfg.User), true
+}
+
+// getControlNames maps each ControlPath to a connection name, using the
+// connections in the local cache
+func getControlNames() map[string]string {
+	names := map[string]string{}
+
+	files, err := getCacheFiles()
+	if err != nil {
+		return names
+	}
+
+	for _, f := range files {
+		var data map[string]interface{}
+		if read, err := os.ReadFile(f.Path); err != nil || json.Unmarshal(read, &data) != nil {
+			continue
+		}
+		names[ssh.GetControlPath(data, cfg.User)] = qualifyConnectionName(f.NameSpace, f.Name)
+	}
+	return names
+}
+
+// formatForwards produces a summary of the forwards for a master
+// forwards : the local ports, keyed by the name of the forward
+func formatForwards(forwards map[string]uint16) string {
+	var parts []string
+	for _, k := range slices.Sorted(maps.Keys(forwards)) {
+		parts = append(parts, fmt.Sprintf("%s=%d", k, forwards[k]))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ",")
+}
+
+// ctlStatus checks whether a master is running for a connection
+func ctlStatus(vc *vaultApi.Client, key string) bool {
+	log.Debugf("ctlStatus: %v", key)
+	currentCommand = "ctl"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+
+	path, ok := getControlPath(vc, key)
+	if !ok {
+		return false
+	}
+
+	out, err := ssh.Control(path, "check")
+	if err != nil {
+		log.Debugf("ssh -O check: %v", out)
+		fmt.Printf("%s: no master running\n", key)
+		return false
+	}
+	fmt.Printf("%s: %s\n", key, out)
+
+	if forwards, err := ssh.ReadForwardCache(path); err == nil && len(forwards) > 0 {
+		fmt.Printf("Forwards: %s\n", formatForwards(forwards))
+	}
+	return true
+}
+
+// ctlStop requests that the master for a connection exits
+func ctlStop(vc *vaultApi.Client, key string) bool {
+	log.Debugf("ctlStop: %v", key)
+	currentCommand = "ctl"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+
+	path, ok := getControlPath(vc, key)
+	if !ok {
+		return false
+	}
+
+	if cfg.Simulate {
+		log.Infof("simulated stop of master for '%v'", key)
+		return true
+	}
+
+	if out, err := ssh.Control(path, "exit"); err != nil {
+		log.Errorf("Failed to stop master for '%v': %v", key, out)
+		return false
+	}
+	fmt.Printf("Stopped master for %s\n", key)
+	return true
+}
+
+// ctlList displays the running masters, along with their forwards
+func ctlList() bool {
+	log.Debug("ctlList")
+	currentCommand = "ctl"
+
+	sockets, err := ssh.ListControlSockets(cfg.StoragePath)
+	if err != nil {
+		log.Errorf("Unable to read '%v': %v", cfg.StoragePath, err)
+		return false
+	}
+	names := getControlNames()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONNECTION\tSTATUS\tFORWARDS")
+
+	for _, path := range sockets {
+		out, err := ssh.Control(path, "check")
+		if err != nil {
+			log.Debugf("Ignoring stale socket '%v': %v", path, out)
+			continue
+		}
+
+		name, ok := names[path]
+		if !ok {
+			name = filepath.Base(path)
+		}
+
+		forwards, _ := ssh.ReadForwardCache(path)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, out, formatForwards(forwards))
+	}
+	w.Flush()
+	return true
+}
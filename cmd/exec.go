@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+// Exec flags
+var (
+	execJSON     bool
+	execParallel = 10
+	execPattern  string
+)
+
+// execResult is the outcome of running a command on a connection
+type execResult struct {
+	Connection string `json:"connection"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// prefixWriter prefixes each line of output with the connection
+type prefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+// Write outputs each complete line, keeping any partial line until the next write
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush outputs any remaining partial line
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+// writeLine outputs a line, preventing lines from other connections interleaving
+func (w *prefixWriter) writeLine(line []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintf(w.out, "%s: %s", w.prefix, line)
+}
+
+// filterConnections returns the connections that match a pattern, excluding locks
+// connections : the available connections
+// pattern : regular expression to match
+func filterConnections(connections []string, pattern string) ([]string, error) {
+	var matched []string
+
+	search, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range connections {
+		if strings.HasPrefix(c, LockPrefix) || !search.MatchString(c) {
+			continue
+		}
+		matched = append(matched, c)
+	}
+	slices.Sort(matched)
+	return matched, nil
+}
+
+// runParallel calls fn for each connection using a bounded pool of workers,
+// returning the results in the same order as the connections
+// keys : the connections
+// workers : the maximum number of concurrent calls
+// fn : the function to call for each connection
+func runParallel(keys []string, workers int, fn func(key string) execResult) []execResult {
+	results := make([]execResult, len(keys))
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = fn(keys[i])
+			}
+		}()
+	}
+
+	for i := range keys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// execConnections runs a command on each connection that matches a pattern
+// and the tags selected with --tag, across all of the available namespaces
+// vc : Vault client
+// pattern : regular expression to select the connections
+// command : the command to run
+func execConnections(vc *vaultApi.Client, pattern string, command []string) bool {
+	log.Debugf("execConnections: %v %v", pattern, command)
+	currentCommand = "exec"
+
+	if len(command) == 0 {
+		log.Error("Please specify the command to run after --")
+		return false
+	} else if pattern == "" && len(tagFilters) == 0 {
+		log.Error("Please specify the connections to use with --pattern and/or --tag")
+		return false
+	}
+
+	filters, err := parseTagFilters(tagFilters)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		log.Errorf("Invalid pattern '%v': %v", pattern, err)
+		return false
+	}
+
+	// Connections are prepared in turn, as the lookups are not safe for concurrent use
+	keys := []string{}
+	sshArgs := map[string][]string{}
+	errs := map[string]error{}
+	forEachNameSpace(func(ns string) {
+		connections, err := getConnections(vc)
+		if err != nil {
+			log.Infof("No connections found in %v: %v", ns, err)
+			return
+		}
+		if len(filters) > 0 {
+			connections = filterTaggedConnections(vc, connections, filters)
+		}
+
+		matched, _ := filterConnections(connections, pattern)
+		for _, key := range matched {
+			name := qualifyConnectionName(ns, key)
+			keys = append(keys, name)
+
+			sshClient, err := renderConnection(vc, key)
+			if err != nil {
+				log.Warningf("Unable to prepare '%v': %v", name, err)
+				errs[name] = err
+				continue
+			}
+			sshArgs[name] = sshClient.ExecArgs(command)
+
+			if cfg.Simulate {
+				fmt.Printf("%s: ssh %s\n", name, strings.Join(sshArgs[name], " "))
+			}
+		}
+	})
+
+	if len(keys) == 0 {
+		log.Errorf("No connections match '%v' %v", pattern, tagFilters)
+		return false
+	}
+
+	if cfg.Simulate {
+		return true
+	}
+
+	mu := sync.Mutex{}
+	results := runParallel(keys, execParallel, func(key string) execResult {
+		result := execResult{Connection: key}
+		args, ok := sshArgs[key]
+		if !ok {
+			result.ExitCode, result.Error = -1, errs[key].Error()
+			return result
+		}
+
+		var stdout, stderr io.Writer
+		var outBuf, errBuf bytes.Buffer
+
+		if execJSON {
+			stdout, stderr = &outBuf, &errBuf
+		} else {
+			outWriter := &prefixWriter{mu: &mu, out: os.Stdout, prefix: key}
+			errWriter := &prefixWriter{mu: &mu, out: os.Stderr, prefix: key}
+			defer outWriter.Flush()
+			defer errWriter.Flush()
+			stdout, stderr = outWriter, errWriter
+		}
+
+		code, err := ssh.Exec(args, stdout, stderr)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.ExitCode = code
+		result.Stdout, result.Stderr = outBuf.String(), errBuf.String()
+		return result
+	})
+
+	failed := []string{}
+	for _, r := range results {
+		if r.ExitCode != 0 {
+			failed = append(failed, fmt.Sprintf("%s (%d)", r.Connection, r.ExitCode))
+		}
+	}
+
+	if execJSON {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Errorf("Failed to generate JSON: %v", err)
+			return false
+		}
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("\n%d succeeded, %d failed\n", len(results)-len(failed), len(failed))
+		if len(failed) > 0 {
+			fmt.Println("Failed:", strings.Join(failed, ", "))
+		}
+	}
+	return len(failed) == 0
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestFilterConnections(t *testing.T) {
+	connections := []string{"db2", LockPrefix + "db1", "web1", "db1"}
+
+	keys, err := filterConnections(connections, "^db")
+	if err != nil || !slices.Equal(keys, []string{"db1", "db2"}) {
+		t.Fatalf("expected: [db1 db2] got: %v (%v)", keys, err)
+	}
+	if _, err := filterConnections(connections, "("); err == nil {
+		t.Fatal("expected: an error for an invalid pattern")
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "e"}
+
+	results := runParallel(keys, 2, func(key string) execResult {
+		return execResult{Connection: key}
+	})
+	for i, r := range results {
+		if r.Connection != keys[i] {
+			t.Fatalf("expected: %v got: %v", keys[i], r.Connection)
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{mu: &sync.Mutex{}, out: &out, prefix: "db1"}
+
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\nthree"))
+	w.Flush()
+
+	if expected := "db1: one\ndb1: two\ndb1: three\n"; out.String() != expected {
+		t.Fatalf("expected: %q got: %q", expected, out.String())
+	}
+}
+
+func TestRenderConnection(t *testing.T) {
+	storagePath := cfg.StoragePath
+	defer func() { cfg.StoragePath = storagePath }()
+	cfg.StoragePath = t.TempDir()
+
+	saveCache("exec-db", map[string]interface{}{"HostName": "10.0.0.1", "Forwards": "mysql:3306"})
+	saveCache("exec-loop", map[string]interface{}{"HostName": "10.0.0.2", "ProxyJump": "exec-loop"})
+
+	sshClient, err := renderConnection(nil, "exec-db")
+	if err != nil || sshClient.HostName != "10.0.0.1" || len(sshClient.LocalForward) != 0 {
+		t.Fatalf("expected: 10.0.0.1 without forwards, got: %v, %v", sshClient, err)
+	}
+	if files, err := os.ReadDir(cfg.StoragePath); err != nil || len(files) != 2 {
+		t.Fatalf("expected: no forwards to be saved, got: %v, %v", files, err)
+	}
+
+	if _, err := renderConnection(nil, "exec-loop"); err == nil {
+		t.Fatal("expected: an error for a ProxyJump cycle")
+	}
+}
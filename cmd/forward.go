@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+// forwardAdd requests an extra LocalForward from the running master
+// for a connection
+// key : the connection
+// spec : the name of the forward, a port or a service definition
+func forwardAdd(vc *vaultApi.Client, key string, spec string) bool {
+	log.Debugf("forwardAdd: %v (%v)", key, spec)
+	currentCommand = "forward"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+
+	data := lookupConnection(vc, key)
+	if data == nil {
+		log.Errorf("Unable to find connection '%v'", key)
+		return false
+	}
+
+	svc, err := ssh.ResolveForward(data, spec)
+	if err != nil {
+		log.Errorf("Invalid forward '%v': %v", spec, err)
+		return false
+	}
+
+	if cfg.Simulate {
+		log.Infof("simulated forward of '%v' for '%v'", svc.Name, key)
+		return true
+	}
+
+	lf, err := ssh.AddForward(ssh.GetControlPath(data, cfg.User), svc)
+	if err != nil {
+		log.Errorf("Failed to add forward for '%v': %v", key, err)
+		return false
+	}
+	fmt.Println(formatForward(lf))
+	return true
+}
+
+// forwardCancel removes a LocalForward from the running master for
+// a connection
+// key : the connection
+// spec : the name of the forward, a port or a service definition
+func forwardCancel(vc *vaultApi.Client, key string, spec string) bool {
+	log.Debugf("forwardCancel: %v (%v)", key, spec)
+	currentCommand = "forward"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+
+	data := lookupConnection(vc, key)
+	if data == nil {
+		log.Errorf("Unable to find connection '%v'", key)
+		return false
+	}
+
+	svc, err := ssh.ResolveForward(data, spec)
+	if err != nil {
+		log.Errorf("Invalid forward '%v': %v", spec, err)
+		return false
+	}
+
+	if cfg.Simulate {
+		log.Infof("simulated cancel of '%v' for '%v'", svc.Name, key)
+		return true
+	}
+
+	lf, err := ssh.CancelForward(ssh.GetControlPath(data, cfg.User), svc)
+	if err != nil {
+		log.Errorf("Failed to cancel forward for '%v': %v", key, err)
+		return false
+	}
+	fmt.Printf("Cancelled forward from port %d for %s\n", lf.LocalPort, key)
+	return true
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	vaultHelper "github.com/cezmunsta/ssh_ms/vault"
+)
+
+// Revision flags
+var (
+	diffFrom        int
+	diffTo          int
+	rollbackVersion int
+)
+
+// historyConnection displays the revisions of a connection
+func historyConnection(vc *vaultApi.Client, key string) bool {
+	log.Debugf("historyConnection: %v", key)
+	currentCommand = "history"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+
+	versions, err := vaultHelper.ListSecretVersions(vc, getSecretKey(key))
+	if err != nil {
+		log.Errorf("Unable to retrieve history for '%v': %v", key, err)
+		return false
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCREATED\tMODIFIED BY\tSTATUS")
+
+	for _, v := range versions {
+		status, modifiedBy := "active", "-"
+		if v.Destroyed {
+			status = "destroyed"
+		} else if !v.DeletionTime.IsZero() {
+			status = "deleted " + v.DeletionTime.Format(time.RFC3339)
+		} else if data, err := vaultHelper.ReadSecretVersion(vc, getSecretKey(key), v.Version); err == nil {
+			if val, ok := data["ModifiedBy"]; ok {
+				modifiedBy = fmt.Sprintf("%v", val)
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", v.Version, v.CreatedTime.Format(time.RFC3339), modifiedBy, status)
+	}
+	w.Flush()
+	return true
+}
+
+// diffSecretData compares two revisions of a connection
+// from : the older revision
+// to : the newer revision
+func diffSecretData(from map[string]interface{}, to map[string]interface{}) []string {
+	var lines []string
+	keys := map[string]bool{}
+
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(keys)) {
+		a, inFrom := from[k]
+		b, inTo := to[k]
+
+		switch {
+		case inFrom && !inTo:
+			lines = append(lines, fmt.Sprintf("- %s=%v", k, a))
+		case !inFrom && inTo:
+			lines = append(lines, fmt.Sprintf("+ %s=%v", k, b))
+		case fmt.Sprintf("%v", a) != fmt.Sprintf("%v", b):
+			lines = append(lines, fmt.Sprintf("- %s=%v", k, a))
+			lines = append(lines, fmt.Sprintf("+ %s=%v", k, b))
+		}
+	}
+	return lines
+}
+
+// diffConnection displays the changes between two revisions of a connection
+// from : the older revision, defaults to the one before the latest
+// to : the newer revision, defaults to the latest
+func diffConnection(vc *vaultApi.Client, key string, from int, to int) bool {
+	log.Debugf("diffConnection: %v (%d..%d)", key, from, to)
+	currentCommand = "diff"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+
+	versions, err := vaultHelper.ListSecretVersions(vc, getSecretKey(key))
+	if err != nil {
+		log.Errorf("Unable to retrieve history for '%v': %v", key, err)
+		return false
+	}
+	if len(versions) == 0 {
+		log.Errorf("No revisions found for '%v'", key)
+		return false
+	}
+
+	latest := versions[len(versions)-1].Version
+	if to == 0 {
+		to = latest
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || to > latest || from >= to {
+		log.Errorf("Invalid range %d..%d for '%v', available versions are 1..%d", from, to, key, latest)
+		return false
+	}
+
+	fromData, err := vaultHelper.ReadSecretVersion(vc, getSecretKey(key), from)
+	if err != nil {
+		log.Errorf("Unable to read version %d of '%v': %v", from, key, err)
+		return false
+	}
+	toData, err := vaultHelper.ReadSecretVersion(vc, getSecretKey(key), to)
+	if err != nil {
+		log.Errorf("Unable to read version %d of '%v': %v", to, key, err)
+		return false
+	}
+
+	fmt.Printf("--- %s@%d\n+++ %s@%d\n", key, from, key, to)
+	for _, line := range diffSecretData(fromData, toData) {
+		fmt.Println(line)
+	}
+	return true
+}
+
+// rollbackConnection restores a previous revision of a connection, writing
+// it as a new version in the same way as update. The tags are kept, as
+// they are not part of the revisions
+// version : the revision to restore
+func rollbackConnection(vc *vaultApi.Client, key string, version int) bool {
+	log.Debugf("rollbackConnection: %v (%d)", key, version)
+	currentCommand = "rollback"
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+
+	if version < 1 {
+		log.Error("Please specify the version to restore using --version")
+		return false
+	}
+
+	current, latest, err := getRawConnectionVersioned(vc, key)
+	if err != nil {
+		return false
+	} else if !vaultHelper.IsVersioned(vc, getSecretKey(key)) {
+		log.Errorf("Unable to rollback '%v': revisions are only available for KV v2 mounts", key)
+		return false
+	} else if version >= latest {
+		log.Errorf("Invalid version %d for '%v', available versions are 1..%d", version, key, latest-1)
+		return false
+	}
+
+	conn, err := vaultHelper.ReadSecretVersion(vc, getSecretKey(key), version)
+	if err != nil || conn == nil {
+		log.Errorf("Unable to read version %d of '%v', it may have been deleted: %v", version, key, err)
+		return false
+	}
+
+	delete(conn, "Tags")
+	if tags, ok := current["Tags"]; ok {
+		conn["Tags"] = tags
+	}
+	conn["ModifiedBy"] = getCurrentUser()
+
+	if cfg.Simulate {
+		log.Infof("simulated rollback of '%v' to version %d: %v", key, version, conn)
+		return true
+	}
+
+	if _, err := storeConnection(vc, key, conn, latest); err != nil {
+		log.Errorf("Failed to rollback '%v' to version %d: %v", key, version, err)
+		return false
+	}
+	saveCache(key, conn)
+	fmt.Printf("Restored version %d of %s as version %d\n", version, key, latest+1)
+	return true
+}
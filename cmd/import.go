@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/config"
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+// importMultiValueKeys may be specified more than once, with the values
+// being combined using the separator
+var importMultiValueKeys = map[string]string{
+	"Forwards":      ",",
+	"IdentityFile":  ",",
+	"RemoteForward": ",",
+	"SendEnv":       " ",
+	"SetEnv":        " ",
+}
+
+// importCandidate is a connection that has been converted from ssh_config
+type importCandidate struct {
+	Name, Comment string
+	Args          []string
+	seen          map[string]int
+}
+
+// importReport summarises the outcome of an import
+type importReport struct {
+	Candidates  []importCandidate
+	Skipped     map[string]string
+	Unsupported map[string][]string
+}
+
+// add applies an option, keeping the first value obtained for most
+// keywords as ssh does, and every value for those that can be repeated
+// key : the keyword
+// value : the value for the keyword
+func (c *importCandidate) add(key string, value string) {
+	idx, ok := c.seen[key]
+	if !ok {
+		c.seen[key] = len(c.Args)
+		c.Args = append(c.Args, fmt.Sprintf("%s=%s", key, value))
+		return
+	}
+
+	sep := importMultiValueKeys[key]
+	if sep == "" {
+		log.Warningf("Ignoring additional %s for '%s': %s", key, c.Name, value)
+		return
+	}
+	_, existing, _ := strings.Cut(c.Args[idx], "=")
+	if !slices.Contains(strings.Split(existing, sep), value) {
+		c.Args[idx] += sep + value
+	}
+}
+
+// importLocalForward converts a LocalForward into a named forward, as the
+// local port is allocated when connecting
+// value : the LocalForward specification, i.e. [bind_address:]port host:hostport
+func importLocalForward(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unsupported LocalForward '%s'", value)
+	}
+
+	listen := fields[0][strings.LastIndex(fields[0], ":")+1:]
+	if _, err := strconv.ParseUint(listen, 10, 16); err != nil {
+		return "", fmt.Errorf("unsupported LocalForward '%s'", value)
+	}
+	host, port, err := net.SplitHostPort(fields[1])
+	if err != nil {
+		return "", fmt.Errorf("unsupported LocalForward '%s'", value)
+	}
+
+	name := "lf" + listen
+	spec := "tcp://" + net.JoinHostPort(host, port)
+	if _, err := config.ParseService(name, spec); err != nil {
+		return "", err
+	}
+	return name + ":" + spec, nil
+}
+
+// buildImportCandidates converts ssh_config entries into connection arguments,
+// combining the blocks for each host in the order that ssh reads them
+// entries : Host blocks read from ssh_config
+func buildImportCandidates(entries []ssh.ConfigEntry) importReport {
+	report := importReport{
+		Skipped:     map[string]string{},
+		Unsupported: map[string][]string{},
+	}
+	candidates := map[string]*importCandidate{}
+	var order []string
+
+	for _, entry := range entries {
+		if entry.Match != "" {
+			report.Skipped["Match "+entry.Match] = "Match blocks are not supported"
+			continue
+		}
+
+		var hosts []*importCandidate
+		for _, host := range entry.Hosts {
+			if strings.ContainsAny(host, "*?!") {
+				report.Skipped[host] = "wildcard patterns are not supported"
+				continue
+			}
+			c, ok := candidates[host]
+			if !ok {
+				c = &importCandidate{Name: host, seen: map[string]int{}}
+				candidates[host] = c
+				order = append(order, host)
+			}
+			if c.Comment == "" {
+				c.Comment = entry.Comment
+			}
+			hosts = append(hosts, c)
+		}
+
+		for _, opt := range entry.Options {
+			kw, ok := config.LookupKeyword(opt.Keyword)
+			if !ok || kw.Internal {
+				report.Unsupported[opt.Keyword] = append(report.Unsupported[opt.Keyword], entry.Hosts...)
+				continue
+			}
+			if err := kw.Validate(opt.Value); err != nil {
+				log.Warning(err)
+				invalid := fmt.Sprintf("%s %s", opt.Keyword, opt.Value)
+				report.Unsupported[invalid] = append(report.Unsupported[invalid], entry.Hosts...)
+				continue
+			}
+
+			key, value := kw.Name, opt.Value
+			if key == "LocalForward" {
+				forward, err := importLocalForward(value)
+				if err != nil {
+					log.Warning(err)
+					invalid := fmt.Sprintf("%s %s", opt.Keyword, opt.Value)
+					report.Unsupported[invalid] = append(report.Unsupported[invalid], entry.Hosts...)
+					continue
+				}
+				key, value = "Forwards", forward
+			}
+
+			for _, c := range hosts {
+				c.add(key, value)
+			}
+		}
+	}
+
+	for _, host := range order {
+		c := candidates[host]
+		if c.Comment == "" {
+			c.Comment = host
+		}
+		report.Candidates = append(report.Candidates, *c)
+	}
+	return report
+}
+
+// importConnections reads an ssh_config file and writes each Host entry to Vault
+// vc : Vault client, only required when not simulating
+// path : location of the ssh_config file
+func importConnections(vc *vaultApi.Client, path string) bool {
+	log.Debugf("importConnections: %v", path)
+	currentCommand = "import"
+
+	entries, err := ssh.ParseConfig(path)
+	if err != nil {
+		log.Errorf("Failed to parse '%v': %v", path, err)
+		return false
+	}
+
+	report := buildImportCandidates(entries)
+	imported := 0
+
+	for _, c := range report.Candidates {
+		if cfg.Simulate {
+			fmt.Printf("%s (%s): %s\n", c.Name, c.Comment, strings.Join(c.Args, " "))
+			continue
+		}
+
+		cfg.ConfigComment = c.Comment
+		if writeConnection(vc, c.Name, c.Args) {
+			imported++
+		} else {
+			report.Skipped[c.Name] = "failed to write, or already exists"
+		}
+	}
+
+	if !cfg.Simulate {
+		fmt.Printf("Imported %d of %d connections into %s\n", imported, len(report.Candidates), getSecretPath())
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(report.Skipped)) {
+		fmt.Printf("Skipped %s: %s\n", name, report.Skipped[name])
+	}
+
+	if len(report.Unsupported) > 0 {
+		fmt.Println("The following keywords are unknown or invalid and were ignored:")
+		for _, k := range slices.Sorted(maps.Keys(report.Unsupported)) {
+			fmt.Printf("  %s (%s)\n", k, strings.Join(report.Unsupported[k], ", "))
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+func TestBuildImportCandidates(t *testing.T) {
+	entries := []ssh.ConfigEntry{
+		{Hosts: []string{"*"}, Options: []ssh.ConfigOption{{Keyword: "ForwardAgent", Value: "no"}}},
+		{
+			Hosts:   []string{"gateway", "gw-*"},
+			Comment: "The gateway",
+			Options: []ssh.ConfigOption{
+				{Keyword: "hostname", Value: "192.168.0.1"},
+				{Keyword: "IdentityFile", Value: "~/.ssh/one"},
+				{Keyword: "IdentityFile", Value: "~/.ssh/two"},
+				{Keyword: "StrictHostKeyChecking", Value: "accept-new"},
+				{Keyword: "LogLevel", Value: "LOUD"},
+				{Keyword: "UseRoaming", Value: "no"},
+				{Keyword: "RemoteForward", Value: "9000 localhost:9000"},
+				{Keyword: "RemoteForward", Value: "9001 localhost:9001"},
+			},
+		},
+		{
+			Hosts: []string{"gateway"},
+			Options: []ssh.ConfigOption{
+				{Keyword: "HostName", Value: "10.0.0.1"},
+				{Keyword: "IdentityFile", Value: "~/.ssh/three"},
+				{Keyword: "LocalForward", Value: "8080 intranet:80"},
+				{Keyword: "LocalForward", Value: "127.0.0.1:3306 localhost:3306"},
+				{Keyword: "LocalForward", Value: "/tmp/socket /var/run/app.sock"},
+			},
+		},
+		{Match: "all"},
+	}
+
+	report := buildImportCandidates(entries)
+	if len(report.Candidates) != 1 {
+		t.Fatalf("expected: 1 candidate, got: %v", report.Candidates)
+	}
+
+	c := report.Candidates[0]
+	if c.Name != "gateway" || c.Comment != "The gateway" {
+		t.Fatalf("expected: gateway with comment, got: %v", c)
+	}
+	if len(c.Args) != 5 || c.Args[0] != "HostName=192.168.0.1" || c.Args[1] != "IdentityFile=~/.ssh/one,~/.ssh/two,~/.ssh/three" {
+		t.Fatalf("expected: the first HostName and every IdentityFile, got: %v", c.Args)
+	}
+	if c.Args[2] != "StrictHostKeyChecking=accept-new" {
+		t.Fatalf("expected: StrictHostKeyChecking, got: %v", c.Args[2])
+	}
+	if c.Args[3] != "RemoteForward=9000 localhost:9000,9001 localhost:9001" {
+		t.Fatalf("expected: combined RemoteForward, got: %v", c.Args[3])
+	}
+	if c.Args[4] != "Forwards=lf8080:tcp://intranet:80,lf3306:tcp://localhost:3306" {
+		t.Fatalf("expected: LocalForward as Forwards, got: %v", c.Args[4])
+	}
+
+	for _, k := range []string{"UseRoaming", "LogLevel LOUD", "LocalForward /tmp/socket /var/run/app.sock"} {
+		if _, ok := report.Unsupported[k]; !ok {
+			t.Fatalf("expected: %v to be unsupported, got: %v", k, report.Unsupported)
+		}
+	}
+
+	for _, k := range []string{"*", "gw-*", "Match all"} {
+		if _, ok := report.Skipped[k]; !ok {
+			t.Fatalf("expected: %v to be skipped, got: %v", k, report.Skipped)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	vaultHelper "github.com/cezmunsta/ssh_ms/vault"
+)
+
+// Lock flags
+var lockForce bool
+
+// listLocks displays the locks that are present in each namespace
+func listLocks(vc *vaultApi.Client) bool {
+	log.Debug("listLocks")
+	currentCommand = "locks"
+	prefix := getLockName("")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tCONNECTION\tUSER\tEXPIRES\tSTATUS")
+
+	forEachNameSpace(func(ns string) {
+		names, err := getConnections(vc)
+		if err != nil {
+			log.Infof("No connections found in %v: %v", ns, err)
+			return
+		}
+
+		for _, name := range names {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+
+			lock, err := getRawConnection(vc, name)
+			if err != nil {
+				continue
+			}
+
+			status := "active"
+			expired, expires := lockExpired(lock)
+			if expired {
+				status = "expired"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\t%s\t%s\n", ns, strings.TrimPrefix(name, prefix), lock["User"], expires.Format(time.RFC3339), status)
+		}
+	})
+	w.Flush()
+	return true
+}
+
+// breakLock removes the lock for a connection
+// force : remove the lock even if it has not expired
+func breakLock(vc *vaultApi.Client, key string, force bool) bool {
+	log.Debugf("breakLock: %v (force: %v)", key, force)
+	currentCommand = "locks"
+	key, ok := parseConnectionName(key)
+	if !ok {
+		return false
+	}
+	ln := getLockName(key)
+
+	lock, err := getRawConnection(vc, ln)
+	if err != nil {
+		log.Errorf("No lock found for '%v'", key)
+		return false
+	}
+
+	if expired, expires := lockExpired(lock); !expired && !force {
+		log.Errorf("The lock for '%v' is held by %v until %v, use --force to break it", key, lock["User"], expires)
+		return false
+	}
+
+	if cfg.Simulate {
+		log.Infof("simulated break of lock for '%v'", key)
+		return true
+	}
+
+	if _, err := vaultHelper.DestroySecret(vc, getLockPath(ln)); err != nil {
+		log.Errorf("Failed to break lock for '%v': %v", key, err)
+		return false
+	}
+	fmt.Printf("Removed lock for %s held by %v\n", key, lock["User"])
+	return true
+}
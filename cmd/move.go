@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	vaultHelper "github.com/cezmunsta/ssh_ms/vault"
+)
+
+// Move flags
+var moveNameSpace string
+
+// getMoveDestination determines the namespace and name for the copy of a
+// connection, which keep those of the original unless changed
+// ns : the namespace of the original
+// key : the name of the original
+// dest : the new name, optionally qualified with the namespace
+// toNameSpace : the namespace selected with --to-namespace
+func getMoveDestination(ns string, key string, dest string, toNameSpace string) (string, string, error) {
+	destNameSpace, destName := ns, key
+
+	if dest != "" {
+		qualified, name, err := splitConnectionName(dest)
+		if err != nil {
+			return "", "", err
+		}
+		destName = name
+		if qualified != "" {
+			destNameSpace = qualified
+		}
+	}
+
+	if toNameSpace != "" {
+		if destNameSpace = matchNameSpace(toNameSpace); destNameSpace == "" {
+			return "", "", fmt.Errorf("unknown namespace '%s', expected one of: %s", toNameSpace, cfg.SecretPath)
+		}
+	}
+
+	if destNameSpace == ns && destName == key {
+		return "", "", fmt.Errorf("the destination is the same as '%s'", qualifyConnectionName(ns, key))
+	}
+	return destNameSpace, destName, nil
+}
+
+// moveConnection copies an entry to a new name and/or namespace, including
+// the comment, MOTD and tags, then removes the original unless keep is set.
+// The original is locked throughout and only removed once the copy has
+// been written; on KV v2 mounts it is soft-deleted, so it is no longer
+// listed but can be restored with undelete. The ControlPath depends on the
+// host rather than the name, so any running master and its forwards remain
+// in use
+// vc : Vault client
+// key : the connection
+// dest : the new name, optionally qualified with the namespace
+// keep : leave the original in place, i.e. copy rather than move
+func moveConnection(vc *vaultApi.Client, key string, dest string, keep bool) bool {
+	log.Debugf("moveConnection: %v %v (keep: %v)", key, dest, keep)
+	currentCommand = "mv"
+	if keep {
+		currentCommand = "copy"
+	}
+
+	key, ok := resolveConnection(vc, key)
+	if !ok {
+		return false
+	}
+	srcNameSpace := getSecretPath()
+
+	conn, err := getRawConnection(vc, key)
+	if err != nil {
+		log.Errorf("Unable to find connection '%v'", key)
+		return false
+	}
+
+	destNameSpace, destName, err := getMoveDestination(srcNameSpace, key, dest, moveNameSpace)
+	if err != nil {
+		log.Errorf("Unable to %s '%v': %v", currentCommand, key, err)
+		return false
+	}
+	src, target := qualifyConnectionName(srcNameSpace, key), qualifyConnectionName(destNameSpace, destName)
+
+	if cfg.Simulate {
+		log.Infof("simulated %s of '%v' to '%v'", currentCommand, src, target)
+		return true
+	}
+
+	if status, lockName := acquireLock(vc, key); status && lockName != "nolock" {
+		defer func() {
+			cfg.NameSpace = srcNameSpace
+			releaseLock(vc, lockName)
+		}()
+	} else {
+		log.Errorf("Failed to acquire lock for '%v'", src)
+		return false
+	}
+
+	cfg.NameSpace = destNameSpace
+	if existing, _ := vaultHelper.ReadSecret(vc, getSecretKey(destName)); existing != nil {
+		log.Errorf("Existing connection found for '%v'", target)
+		return false
+	}
+
+	conn["ModifiedBy"] = getCurrentUser()
+	if _, err := storeConnection(vc, destName, conn, getReplaceableVersion(vc, destName)); err != nil {
+		log.Errorf("Failed to write '%v': %v", target, err)
+		return false
+	}
+	saveCache(destName, conn)
+
+	if keep {
+		fmt.Printf("Copied %s to %s\n", src, target)
+		return true
+	}
+
+	cfg.NameSpace = srcNameSpace
+	if _, err := vaultHelper.DeleteSecret(vc, getSecretKey(key)); err != nil {
+		log.Errorf("Copied '%v' to '%v', but failed to delete the original: %v", src, target, err)
+		return false
+	}
+	removeCache(key)
+
+	fmt.Printf("Moved %s to %s\n", src, target)
+	return true
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/cezmunsta/ssh_ms/helpers"
+)
+
+func TestGetMoveDestination(t *testing.T) {
+	secretPath := cfg.SecretPath
+	defer func() { cfg.SecretPath = secretPath }()
+	cfg.SecretPath = "secret/ssh_ms,secret/other"
+
+	for _, tc := range []struct {
+		dest, toNameSpace string
+		expected          []string
+	}{
+		{"gateway-eu", "", []string{"secret/ssh_ms", "gateway-eu"}},
+		{"", "other", []string{"secret/other", "gateway"}},
+		{"other:gateway-eu", "", []string{"secret/other", "gateway-eu"}},
+		{"gateway-eu", "secret/other", []string{"secret/other", "gateway-eu"}},
+		{"", "", nil},
+		{"gateway", "ssh_ms", nil},
+		{"", "missing", nil},
+		{"missing:gateway", "", nil},
+	} {
+		ns, name, err := getMoveDestination("secret/ssh_ms", "gateway", tc.dest, tc.toNameSpace)
+		if tc.expected == nil {
+			if err == nil {
+				t.Fatalf("expected: an error for %v got: %v, %v", tc, ns, name)
+			}
+			continue
+		}
+		if err != nil || ns != tc.expected[0] || name != tc.expected[1] {
+			t.Fatalf("expected: %v for %v got: %v, %v (%v)", tc.expected, tc, ns, name, err)
+		}
+	}
+}
+
+func TestMoveConnection(t *testing.T) {
+	_, client := getDummyCluster(t)
+	secretPath, nameSpace := cfg.SecretPath, cfg.NameSpace
+	defer func() { cfg.SecretPath, cfg.NameSpace, moveNameSpace = secretPath, nameSpace, "" }()
+
+	paths := helpers.GetVaultSecretPaths()
+	kv1, kv2 := paths[0], paths[1]
+	cfg.SecretPath = kv2 + "," + kv1
+
+	cfg.NameSpace = kv2
+	if _, err := storeConnection(client, "move-gw", secretData{"HostName": "10.0.0.1"}, 0); err != nil {
+		t.Fatalf("expected: move-gw to be written, got: %v", err)
+	}
+
+	// The original name is no longer listed or resolved once renamed
+	cfg.NameSpace = ""
+	if !moveConnection(client, "move-gw", "move-gw-new", false) {
+		t.Fatal("expected: move-gw to be renamed")
+	}
+	cfg.NameSpace = kv2
+	if lookupActiveConnection(client, "move-gw") != nil || lookupActiveConnection(client, "move-gw-new") == nil {
+		t.Fatal("expected: only move-gw-new to be found")
+	}
+	cfg.NameSpace = ""
+	if key, ok := resolveConnection(client, "move-gw-new"); !ok || key != "move-gw-new" || cfg.NameSpace != kv2 {
+		t.Fatalf("expected: move-gw-new in %v, got: %v, %v in %v", kv2, key, ok, cfg.NameSpace)
+	}
+
+	// Moving to another namespace does not leave the connection in both
+	cfg.NameSpace, moveNameSpace = "", kv1
+	if !moveConnection(client, "move-gw-new", "", false) {
+		t.Fatalf("expected: move-gw-new to be moved to %v", kv1)
+	}
+	cfg.NameSpace, moveNameSpace = "", ""
+	if key, ok := resolveConnection(client, "move-gw-new"); !ok || key != "move-gw-new" || cfg.NameSpace != kv1 {
+		t.Fatalf("expected: move-gw-new in %v, got: %v, %v in %v", kv1, key, ok, cfg.NameSpace)
+	}
+
+	// Jump hosts are found in the other namespaces
+	cfg.NameSpace = kv2
+	if data := jumpHostLookup(client)("move-gw-new"); data == nil || cfg.NameSpace != kv2 {
+		t.Fatalf("expected: move-gw-new to be found from %v, got: %v in %v", kv2, data, cfg.NameSpace)
+	}
+}
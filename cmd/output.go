@@ -0,0 +1,384 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/cezmunsta/ssh_ms/config"
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+// Output formats for the read commands
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+	outputText  = "text"
+	outputYAML  = "yaml"
+)
+
+// columnMinWidth is the narrowest a column is reduced to for the terminal
+const columnMinWidth = 4
+
+// outputFormats are the values accepted by --output
+var outputFormats = []string{outputText, outputJSON, outputYAML, outputTable}
+
+// tabular is implemented by output that can be displayed as a table
+type tabular interface {
+	header() []string
+	rows() [][]string
+}
+
+// connectionEntry describes a connection in the output of list and search,
+// with the details only being included for list -l
+type connectionEntry struct {
+	Name      string `json:"name" yaml:"name"`
+	NameSpace string `json:"namespace" yaml:"namespace"`
+	HostName  string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	Port      string `json:"port,omitempty" yaml:"port,omitempty"`
+	User      string `json:"user,omitempty" yaml:"user,omitempty"`
+	ProxyJump string `json:"proxyjump,omitempty" yaml:"proxyjump,omitempty"`
+	Comment   string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+// connectionList is the output of list and search
+type connectionList []connectionEntry
+
+func (l connectionList) header() []string {
+	return []string{"NAME", "NAMESPACE"}
+}
+
+func (l connectionList) rows() [][]string {
+	var rows [][]string
+	for _, e := range l {
+		rows = append(rows, []string{e.Name, e.NameSpace})
+	}
+	return rows
+}
+
+// longConnectionList is the output of list -l
+type longConnectionList []connectionEntry
+
+func (l longConnectionList) header() []string {
+	return []string{"NAME", "NAMESPACE", "HOSTNAME", "PORT", "USER", "PROXYJUMP", "COMMENT"}
+}
+
+func (l longConnectionList) rows() [][]string {
+	var rows [][]string
+	for _, e := range l {
+		rows = append(rows, []string{e.Name, e.NameSpace, e.HostName, e.Port, e.User, e.ProxyJump, e.Comment})
+	}
+	return rows
+}
+
+// connectionOption is an option in the output of show
+type connectionOption struct {
+	Keyword string `json:"keyword" yaml:"keyword"`
+	Value   string `json:"value" yaml:"value"`
+}
+
+// connectionDetails is the output of show
+type connectionDetails struct {
+	Name      string             `json:"name" yaml:"name"`
+	NameSpace string             `json:"namespace" yaml:"namespace"`
+	Comment   string             `json:"comment" yaml:"comment"`
+	Options   []connectionOption `json:"options" yaml:"options"`
+}
+
+func (d connectionDetails) header() []string {
+	return []string{"KEYWORD", "VALUE"}
+}
+
+func (d connectionDetails) rows() [][]string {
+	var rows [][]string
+	for _, o := range d.Options {
+		rows = append(rows, []string{o.Keyword, o.Value})
+	}
+	return rows
+}
+
+// newConnectionDetails describes a connection for show
+// key : the connection
+// comment : the comment for the connection
+// sshClient : the connection built from the stored config
+func newConnectionDetails(key string, comment string, sshClient ssh.Connection) connectionDetails {
+	details := connectionDetails{Name: key, NameSpace: getSecretPath(), Comment: comment, Options: []connectionOption{}}
+
+	if sshClient.HostName == "" {
+		return details
+	}
+	for _, o := range sshClient.Options() {
+		details.Options = append(details.Options, connectionOption{Keyword: o.Keyword, Value: o.Value})
+	}
+	return details
+}
+
+// connectionCommand is the output of print
+type connectionCommand struct {
+	Name    string   `json:"name" yaml:"name"`
+	Command []string `json:"command" yaml:"command"`
+}
+
+func (c connectionCommand) header() []string {
+	return []string{"NAME", "COMMAND"}
+}
+
+func (c connectionCommand) rows() [][]string {
+	return [][]string{{c.Name, strings.Join(c.Command, " ")}}
+}
+
+// versionInfo is the output of version
+type versionInfo struct {
+	Version             string   `json:"version" yaml:"version"`
+	Latest              string   `json:"latest,omitempty" yaml:"latest,omitempty"`
+	Arch                string   `json:"arch" yaml:"arch"`
+	GoVersion           string   `json:"go_version" yaml:"go_version"`
+	VaultAPIVersion     string   `json:"vault_api_version" yaml:"vault_api_version"`
+	VaultSDKVersion     string   `json:"vault_sdk_version" yaml:"vault_sdk_version"`
+	ConfigFile          string   `json:"config_file" yaml:"config_file"`
+	Profile             string   `json:"profile,omitempty" yaml:"profile,omitempty"`
+	BasePath            string   `json:"base_path" yaml:"base_path"`
+	NameSpaces          []string `json:"namespaces" yaml:"namespaces"`
+	VaultAddr           string   `json:"vault_addr" yaml:"vault_addr"`
+	SSHUsername         string   `json:"ssh_username" yaml:"ssh_username"`
+	SSHTemplateUsername string   `json:"ssh_template_username" yaml:"ssh_template_username"`
+	SSHIdentityFile     string   `json:"ssh_identity_file" yaml:"ssh_identity_file"`
+}
+
+func (v versionInfo) header() []string {
+	return []string{"FIELD", "VALUE"}
+}
+
+func (v versionInfo) rows() [][]string {
+	rows := [][]string{{"Version", v.Version}}
+	if v.Latest != "" {
+		rows = append(rows, []string{"Latest Version", v.Latest})
+	}
+	return append(rows,
+		[]string{"Arch", v.Arch},
+		[]string{"Go Version", v.GoVersion},
+		[]string{"Vault API Version", v.VaultAPIVersion},
+		[]string{"Vault SDK Version", v.VaultSDKVersion},
+		[]string{"Config file", v.ConfigFile},
+		[]string{"Profile", v.Profile},
+		[]string{"Base path", v.BasePath},
+		[]string{"Namespaces", strings.Join(v.NameSpaces, ",")},
+		[]string{"Default Vault address", v.VaultAddr},
+		[]string{"Default SSH username", v.SSHUsername},
+		[]string{"SSH template username", v.SSHTemplateUsername},
+		[]string{"SSH identity file", v.SSHIdentityFile},
+	)
+}
+
+// getVersionInfo describes the application, including the latest
+// version when --check is used
+func getVersionInfo() versionInfo {
+	info := versionInfo{
+		Version:             Version,
+		Arch:                runtime.GOOS + "/" + runtime.GOARCH,
+		GoVersion:           runtime.Version(),
+		VaultAPIVersion:     cfg.VaultAPIVersion,
+		VaultSDKVersion:     cfg.VaultSDKVersion,
+		ConfigFile:          cfg.ConfigFile,
+		Profile:             cfg.Profile,
+		BasePath:            cfg.StoragePath,
+		NameSpaces:          strings.Split(cfg.SecretPath, ","),
+		VaultAddr:           cfg.EnvVaultAddr,
+		SSHUsername:         config.EnvSSHDefaultUsername,
+		SSHTemplateUsername: config.EnvSSHUsername,
+		SSHIdentityFile:     cfg.EnvSSHIdentityFile,
+	}
+
+	if cfg.VersionCheck {
+		info.Latest, _ = getLatestVersion()
+	}
+	return info
+}
+
+// placeholderList is the output of inspect placeholders
+type placeholderList map[string]string
+
+func (p placeholderList) header() []string {
+	return []string{"PLACEHOLDER", "TEMPLATE"}
+}
+
+func (p placeholderList) rows() [][]string {
+	var rows [][]string
+	for _, k := range slices.Sorted(maps.Keys(p)) {
+		rows = append(rows, []string{k, p[k]})
+	}
+	return rows
+}
+
+// cacheEntry describes a cached connection
+type cacheEntry struct {
+	Name      string    `json:"name" yaml:"name"`
+	NameSpace string    `json:"namespace" yaml:"namespace"`
+	Modified  time.Time `json:"modified" yaml:"modified"`
+	Expires   time.Time `json:"expires" yaml:"expires"`
+}
+
+// cacheList is the output of cache status
+type cacheList []cacheEntry
+
+func (l cacheList) header() []string {
+	return []string{"NAME", "NAMESPACE", "MODIFIED", "EXPIRES"}
+}
+
+func (l cacheList) rows() [][]string {
+	var rows [][]string
+	for _, e := range l {
+		rows = append(rows, []string{e.Name, e.NameSpace, e.Modified.Format(time.RFC3339), e.Expires.Format(time.RFC3339)})
+	}
+	return rows
+}
+
+// getCacheEntries lists the connections in the local cache, ignoring the
+// files used to track the forwards for ControlMaster sessions
+func getCacheEntries() (cacheList, error) {
+	entries := cacheList{}
+
+	files, err := getCacheFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		fi, err := os.Stat(f.Path)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, cacheEntry{
+			Name:      f.Name,
+			NameSpace: f.NameSpace,
+			Modified:  fi.ModTime().UTC(),
+			Expires:   fi.ModTime().Add(CacheExpireAfter).UTC(),
+		})
+	}
+	return entries, nil
+}
+
+// writeTable displays data as a table
+// w : destination for the output
+// data : the data to display
+func writeTable(w io.Writer, data tabular) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(data.header(), "\t"))
+	for _, row := range data.rows() {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// writeColumns displays data in aligned columns, shrinking the columns
+// after the first one, starting from the last, to fit the width
+// w : destination for the output
+// data : the data to display
+// width : the maximum width of a line, or 0 for no limit
+func writeColumns(w io.Writer, data tabular, width int) {
+	const sep = "  "
+	rows := append([][]string{data.header()}, data.rows()...)
+	widths := make([]int, len(rows[0]))
+
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+
+	total := len(sep) * (len(widths) - 1)
+	for _, cw := range widths {
+		total += cw
+	}
+	for i := len(widths) - 1; i > 0 && width > 0 && total > width; i-- {
+		shrink := min(total-width, widths[i]-min(widths[i], columnMinWidth))
+		widths[i] -= shrink
+		total -= shrink
+	}
+
+	for _, row := range rows {
+		var cells []string
+		for i, cell := range row {
+			if r := []rune(cell); len(r) > widths[i] {
+				cell = string(r[:widths[i]-1]) + "…"
+			}
+			if i < len(row)-1 {
+				cell += strings.Repeat(" ", widths[i]-len([]rune(cell)))
+			}
+			cells = append(cells, cell)
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, sep), " "))
+	}
+}
+
+// getTerminalWidth returns the width available when the output is a
+// terminal, or 0 when there is no limit
+func getTerminalWidth() int {
+	if fi, err := os.Stdout.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return 0
+	}
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return 0
+	}
+	defer tty.Close()
+
+	_, cols := terminalSize(tty)
+	return cols
+}
+
+// writeOutput displays data using the format selected with --output
+// w : destination for the output
+// data : encoded for json and yaml, or displayed as a table
+// text : produces the default output
+func writeOutput(w io.Writer, data interface{}, text func(w io.Writer)) error {
+	switch cfg.Output {
+	case outputJSON:
+		out, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(out))
+	case outputYAML:
+		out, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, string(out))
+	case outputTable:
+		if t, ok := data.(tabular); ok {
+			writeTable(w, t)
+			return nil
+		}
+		text(w)
+	default:
+		text(w)
+	}
+	return nil
+}
+
+// printOutput displays data on stdout using the format selected with --output
+// data : encoded for json and yaml, or displayed as a table
+// text : produces the default output
+func printOutput(data interface{}, text func(w io.Writer)) bool {
+	if err := writeOutput(os.Stdout, data, text); err != nil {
+		log.Errorf("Failed to generate %s output: %v", cfg.Output, err)
+		return false
+	}
+	return true
+}
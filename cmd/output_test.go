@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWriteOutput(t *testing.T) {
+	defer func(output string) { cfg.Output = output }(cfg.Output)
+
+	entries := connectionList{{Name: "db1", NameSpace: "secret/ssh_ms"}, {Name: "web1", NameSpace: "secret/other"}}
+	text := func(w io.Writer) { fmt.Fprintln(w, "db1 web1") }
+
+	for format, check := range map[string]func(out []byte) error{
+		outputText: func(out []byte) error {
+			if string(out) != "db1 web1\n" {
+				return fmt.Errorf("unexpected text: %q", out)
+			}
+			return nil
+		},
+		outputJSON: func(out []byte) error {
+			var decoded connectionList
+			if err := json.Unmarshal(out, &decoded); err != nil || len(decoded) != 2 || decoded[1] != entries[1] {
+				return fmt.Errorf("unexpected json: %s (%v)", out, err)
+			}
+			return nil
+		},
+		outputYAML: func(out []byte) error {
+			var decoded connectionList
+			if err := yaml.Unmarshal(out, &decoded); err != nil || len(decoded) != 2 || decoded[0] != entries[0] {
+				return fmt.Errorf("unexpected yaml: %s (%v)", out, err)
+			}
+			return nil
+		},
+		outputTable: func(out []byte) error {
+			lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+			if len(lines) != 3 || strings.Fields(lines[0])[1] != "NAMESPACE" || strings.Fields(lines[2])[0] != "web1" {
+				return fmt.Errorf("unexpected table: %s", out)
+			}
+			return nil
+		},
+	} {
+		cfg.Output = format
+		b := bytes.Buffer{}
+		if err := writeOutput(&b, entries, text); err != nil {
+			t.Fatalf("expected: %s output got: %v", format, err)
+		}
+		if err := check(b.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Data that cannot be displayed as a table uses the text output
+	cfg.Output = outputTable
+	b := bytes.Buffer{}
+	writeOutput(&b, map[string]string{"a": "b"}, text)
+	if b.String() != "db1 web1\n" {
+		t.Fatalf("expected: text output got: %q", b.String())
+	}
+}
+
+func TestGetCacheEntries(t *testing.T) {
+	defer func(path string) { cfg.StoragePath = path }(cfg.StoragePath)
+	cfg.StoragePath = t.TempDir()
+
+	for _, name := range []string{"db1.json", "web1.json", "notes.txt", "cp_bob_10.0.0.5_22.json", "0123456789abcdef0123456789abcdef01234567.json"} {
+		if err := os.WriteFile(filepath.Join(cfg.StoragePath, name), []byte("{}"), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := getCacheEntries()
+	if err != nil || len(entries) != 2 || entries[0].Name != "db1" {
+		t.Fatalf("expected: db1 and web1 got: %v (%v)", entries, err)
+	}
+	if !entries[0].Expires.Equal(entries[0].Modified.Add(CacheExpireAfter)) {
+		t.Fatalf("expected: expiry after %v got: %v", CacheExpireAfter, entries[0])
+	}
+}
+
+func TestWriteColumns(t *testing.T) {
+	entries := longConnectionList{
+		{Name: "db1", NameSpace: "secret/ssh_ms", HostName: "10.0.0.5", Port: "22", User: "bob", Comment: "Primary database for the reporting cluster"},
+		{Name: "gateway-us-1", NameSpace: "secret/ssh_ms", HostName: "192.168.0.1", Port: "2222", User: "@@SSH_MS_USERNAME", ProxyJump: "bastion"},
+	}
+
+	b := bytes.Buffer{}
+	writeColumns(&b, entries, 0)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[1], "Primary database for the reporting cluster") {
+		t.Fatalf("expected: the full comment without a width got: %q", lines)
+	}
+	if strings.Index(lines[0], "HOSTNAME") != strings.Index(lines[2], "192.168.0.1") {
+		t.Fatalf("expected: aligned columns got: %q", lines)
+	}
+
+	b.Reset()
+	writeColumns(&b, entries, 80)
+	for _, l := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if len([]rune(l)) > 80 || !strings.HasPrefix(l, "NAME") && !strings.HasPrefix(l, "db1") && !strings.HasPrefix(l, "gateway-us-1") {
+			t.Fatalf("expected: lines to fit 80 columns with the full name got: %q", l)
+		}
+	}
+	if !strings.Contains(b.String(), "…") {
+		t.Fatalf("expected: truncated columns got: %q", b.String())
+	}
+}
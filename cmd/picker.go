@@ -0,0 +1,396 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+// Terminal control sequences used by the picker
+const (
+	termAltScreen   = "\x1b[?1049h\x1b[?25l"
+	termClear       = "\x1b[H\x1b[2J"
+	termExitScreen  = "\x1b[?25h\x1b[?1049l"
+	termHighlight   = "\x1b[7m"
+	termReset       = "\x1b[0m"
+	termDefaultRows = 24
+	termDefaultCols = 80
+)
+
+// pickerItem is a connection that can be selected
+type pickerItem struct {
+	Name, NameSpace, Comment string
+}
+
+// label describes the item in the list
+func (i pickerItem) label() string {
+	l := fmt.Sprintf("%s  [%s]", i.Name, i.NameSpace)
+	if i.Comment != "" && i.Comment != i.Name {
+		l += "  # " + i.Comment
+	}
+	return l
+}
+
+// picker is a full-screen fuzzy finder for connections
+type picker struct {
+	items, matches []pickerItem
+	query          string
+	cursor, offset int
+	previews       map[pickerItem]string
+}
+
+// fuzzyScore checks whether each term of the query appears in order in
+// the text, favouring consecutive characters and the start of words
+// query : the terms to look for
+// text : the text to search
+func fuzzyScore(query string, text string) (int, bool) {
+	total := 0
+	t := []rune(strings.ToLower(text))
+
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		score, qi, last := 0, 0, -2
+		q := []rune(term)
+
+		for i, r := range t {
+			if qi == len(q) {
+				break
+			}
+			if r != q[qi] {
+				continue
+			}
+			score++
+			if last == i-1 {
+				score += 2
+			}
+			if i == 0 || !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1]) {
+				score += 3
+			}
+			last = i
+			qi++
+		}
+
+		if qi < len(q) {
+			return 0, false
+		}
+		total += score
+	}
+	return total, true
+}
+
+// filter updates the matches for the current query, best match first
+func (p *picker) filter() {
+	scores := map[pickerItem]int{}
+	p.matches = nil
+
+	for _, item := range p.items {
+		if score, ok := fuzzyScore(p.query, item.Name+" "+item.Comment+" "+item.NameSpace); ok {
+			scores[item] = score
+			p.matches = append(p.matches, item)
+		}
+	}
+
+	slices.SortStableFunc(p.matches, func(a, b pickerItem) int {
+		if scores[a] != scores[b] {
+			return scores[b] - scores[a]
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	p.cursor, p.offset = 0, 0
+}
+
+// handleKey updates the state for a key press, returning whether the
+// picker is finished and if so, whether an item was selected
+// key : the bytes read from the terminal
+func (p *picker) handleKey(key []byte) (bool, bool) {
+	switch k := string(key); k {
+	case "\r", "\n":
+		return true, len(p.matches) > 0
+	case "\x1b", "\x03", "\x04":
+		return true, false
+	case "\x1b[A", "\x1bOA", "\x10", "\x0b":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case "\x1b[B", "\x1bOB", "\x0e":
+		if p.cursor < len(p.matches)-1 {
+			p.cursor++
+		}
+	case "\x7f", "\x08":
+		if r := []rune(p.query); len(r) > 0 {
+			p.query = string(r[:len(r)-1])
+			p.filter()
+		}
+	case "\x15":
+		p.query = ""
+		p.filter()
+	default:
+		if strings.HasPrefix(k, "\x1b") {
+			return false, false
+		}
+		for _, r := range k {
+			if !unicode.IsPrint(r) {
+				return false, false
+			}
+		}
+		p.query += k
+		p.filter()
+	}
+	return false, false
+}
+
+// selected returns the item under the cursor
+func (p *picker) selected() (pickerItem, bool) {
+	if len(p.matches) == 0 {
+		return pickerItem{}, false
+	}
+	return p.matches[p.cursor], true
+}
+
+// render produces the lines for the screen, with the prompt and list
+// at the top and a preview of the selected connection below
+// rows : the height of the terminal
+// cols : the width of the terminal
+func (p *picker) render(rows int, cols int) []string {
+	previewRows := (rows - 3) / 2
+	listRows := max(rows-3-previewRows, 1)
+
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	} else if p.cursor >= p.offset+listRows {
+		p.offset = p.cursor - listRows + 1
+	}
+
+	lines := []string{
+		truncate("> "+p.query, cols),
+		truncate(fmt.Sprintf("  %d/%d", len(p.matches), len(p.items)), cols),
+	}
+
+	for i := p.offset; i < len(p.matches) && i < p.offset+listRows; i++ {
+		if i == p.cursor {
+			lines = append(lines, termHighlight+truncate("> "+p.matches[i].label(), cols)+termReset)
+		} else {
+			lines = append(lines, truncate("  "+p.matches[i].label(), cols))
+		}
+	}
+	for len(lines) < listRows+2 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, strings.Repeat("─", cols))
+
+	if item, ok := p.selected(); ok {
+		for i, l := range strings.Split(strings.TrimRight(p.previews[item], "\n"), "\n") {
+			if i == previewRows {
+				break
+			}
+			lines = append(lines, truncate(l, cols))
+		}
+	}
+	return lines
+}
+
+// truncate shortens a line to fit the width of the terminal
+func truncate(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
+
+// stty configures the terminal
+// tty : the terminal
+// args : the arguments for stty
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalSize returns the number of rows and columns for the terminal
+func terminalSize(tty *os.File) (int, int) {
+	out, err := stty(tty, "size")
+	if err != nil {
+		return termDefaultRows, termDefaultCols
+	}
+
+	size := strings.Fields(out)
+	if len(size) != 2 {
+		return termDefaultRows, termDefaultCols
+	}
+	rows, errRows := strconv.Atoi(size[0])
+	cols, errCols := strconv.Atoi(size[1])
+	if errRows != nil || errCols != nil || rows < 5 || cols < 10 {
+		return termDefaultRows, termDefaultCols
+	}
+	return rows, cols
+}
+
+// run displays the picker until an item is selected or it is cancelled
+func (p *picker) run() (pickerItem, bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return pickerItem{}, false, err
+	}
+	defer tty.Close()
+
+	state, err := stty(tty, "-g")
+	if err != nil {
+		return pickerItem{}, false, err
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return pickerItem{}, false, err
+	}
+	defer stty(tty, state)
+
+	fmt.Fprint(tty, termAltScreen)
+	defer fmt.Fprint(tty, termExitScreen)
+
+	p.filter()
+	buf := make([]byte, 32)
+	for {
+		rows, cols := terminalSize(tty)
+		fmt.Fprint(tty, termClear+strings.Join(p.render(rows, cols), "\r\n"))
+
+		n, err := tty.Read(buf)
+		if err != nil {
+			return pickerItem{}, false, err
+		}
+		if done, ok := p.handleKey(buf[:n]); done {
+			if !ok {
+				return pickerItem{}, false, nil
+			}
+			item, ok := p.selected()
+			return item, ok, nil
+		}
+	}
+}
+
+// previewConnection renders the config for a connection in the same way as
+// show. It is prepared before the picker is displayed and does not build the
+// connection, so that no ports are allocated and nothing is written
+// vc : Vault client
+// item : the connection
+// data : the stored options
+func previewConnection(vc *vaultApi.Client, item pickerItem, data map[string]interface{}) string {
+	comment := item.Comment
+	if comment == "" {
+		comment = item.Name
+	}
+	preview := fmt.Sprintf("# %s\n", comment)
+	if data == nil {
+		return preview
+	}
+
+	sshClient := ssh.Connection{Lookup: jumpHostLookup(vc)}
+	if err := sshClient.RenderConnection(data, item.Name, cfg.User); err != nil {
+		return preview + fmt.Sprintf("# %v\n", err)
+	}
+	return preview + sshClient.Cache.Config
+}
+
+// getPickerItems collects the connections from each of the namespaces,
+// using the local cache where possible
+// vc : Vault client
+func getPickerItems(vc *vaultApi.Client) ([]pickerItem, map[pickerItem]string) {
+	var items []pickerItem
+	previews := map[pickerItem]string{}
+
+	forEachNameSpace(func(ns string) {
+		connections, err := getConnections(vc)
+		if err != nil {
+			return
+		}
+
+		for _, key := range connections {
+			if strings.HasPrefix(key, LockPrefix) {
+				continue
+			}
+			item, preview := newPickerItem(vc, key, ns)
+			items = append(items, item)
+			previews[item] = preview
+		}
+	})
+	return items, previews
+}
+
+// newPickerItem looks up a connection in the current namespace
+// vc : Vault client
+// key : the connection
+// ns : the namespace
+func newPickerItem(vc *vaultApi.Client, key string, ns string) (pickerItem, string) {
+	item := pickerItem{Name: key, NameSpace: ns}
+	data := lookupConnection(vc, key)
+	if data != nil && data["ConfigComment"] != nil {
+		item.Comment = fmt.Sprintf("%v", data["ConfigComment"])
+	}
+	return item, previewConnection(vc, item, data)
+}
+
+// pickNameSpace asks the user to choose between the namespaces that
+// contain a connection
+// vc : Vault client
+// key : the connection
+// namespaces : the namespaces that contain the connection
+func pickNameSpace(vc *vaultApi.Client, key string, namespaces []string) (string, bool) {
+	selectedNameSpace := cfg.NameSpace
+	defer func() { cfg.NameSpace = selectedNameSpace }()
+
+	p := picker{previews: map[pickerItem]string{}}
+	for _, ns := range namespaces {
+		cfg.NameSpace = ns
+		item, preview := newPickerItem(vc, key, ns)
+		p.items = append(p.items, item)
+		p.previews[item] = preview
+	}
+
+	item, ok, err := p.run()
+	if err != nil {
+		log.Errorf("Unable to display the namespaces for '%v': %v", key, err)
+		return "", false
+	}
+	return item.NameSpace, ok
+}
+
+// isTerminal checks whether the input is interactive
+func isTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// pickConnection displays the picker when no connection was specified,
+// returning the arguments with the selected connection
+// vc : Vault client
+// args : the arguments for the command
+func pickConnection(vc *vaultApi.Client, args []string) []string {
+	if len(args) > 0 || !isTerminal() {
+		checkArgs(args, 1)
+		return args
+	}
+	log.Debug("pickConnection")
+
+	p := picker{}
+	p.items, p.previews = getPickerItems(vc)
+
+	if len(p.items) == 0 {
+		log.Fatal("No connections available")
+	}
+
+	item, ok, err := p.run()
+	if err != nil {
+		log.Fatalf("Unable to display the connections: %v", err)
+	} else if !ok {
+		os.Exit(1)
+	}
+
+	cfg.NameSpace = item.NameSpace
+	return []string{item.Name}
+}
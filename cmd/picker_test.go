@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	for query, expected := range map[string]bool{
+		"":         true,
+		"gw":       true,
+		"gate us":  true,
+		"us gate":  true,
+		"gatewayx": false,
+		"euro":     false,
+	} {
+		if _, ok := fuzzyScore(query, "gateway-us-1 Acme"); ok != expected {
+			t.Fatalf("expected: %v for '%s' got: %v", expected, query, ok)
+		}
+	}
+
+	prefix, _ := fuzzyScore("db", "db1")
+	scattered, _ := fuzzyScore("db", "dashboard")
+	if prefix <= scattered {
+		t.Fatalf("expected: consecutive matches to score higher, got: %v <= %v", prefix, scattered)
+	}
+}
+
+func TestPicker(t *testing.T) {
+	p := picker{
+		items: []pickerItem{
+			{Name: "dashboard", NameSpace: "secret"},
+			{Name: "db1", NameSpace: "secret", Comment: "Primary database"},
+			{Name: "web1", NameSpace: "other"},
+		},
+		previews: map[pickerItem]string{},
+	}
+	for _, item := range p.items {
+		p.previews[item] = "Host " + item.Name + "\n   HostName 10.0.0.1\n"
+	}
+	p.filter()
+
+	for _, key := range []string{"d", "b"} {
+		if done, _ := p.handleKey([]byte(key)); done {
+			t.Fatalf("expected: picker to continue after '%s'", key)
+		}
+	}
+	if item, ok := p.selected(); !ok || item.Name != "db1" || len(p.matches) != 2 {
+		t.Fatalf("expected: db1 first of 2 matches got: %v %v", item, p.matches)
+	}
+
+	p.handleKey([]byte("\x1b[B"))
+	if item, _ := p.selected(); item.Name != "dashboard" {
+		t.Fatalf("expected: dashboard got: %v", item)
+	}
+
+	lines := p.render(10, 40)
+	if lines[0] != "> db" || !strings.Contains(strings.Join(lines, "\n"), "Host dashboard") {
+		t.Fatalf("expected: the query and a preview got: %q", lines)
+	}
+	for _, l := range lines {
+		if len([]rune(strings.TrimSuffix(strings.TrimPrefix(l, termHighlight), termReset))) > 40 {
+			t.Fatalf("expected: lines to fit the width got: %q", l)
+		}
+	}
+
+	p.handleKey([]byte("\x7f"))
+	p.handleKey([]byte("\x7f"))
+	if len(p.matches) != 3 {
+		t.Fatalf("expected: all items after clearing the query got: %v", p.matches)
+	}
+
+	if done, ok := p.handleKey([]byte("\r")); !done || !ok {
+		t.Fatal("expected: enter to select an item")
+	}
+	if done, ok := p.handleKey([]byte("\x1b")); !done || ok {
+		t.Fatal("expected: escape to cancel")
+	}
+}
+
+func TestPreviewConnection(t *testing.T) {
+	item := pickerItem{Name: "db1", NameSpace: "secret", Comment: "Primary database"}
+	preview := previewConnection(nil, item, map[string]interface{}{
+		"HostName":      "10.0.0.1",
+		"Forwards":      "mysql:3306",
+		"ConfigComment": "Primary database",
+		"LogLevel":      "quiet",
+	})
+
+	if !strings.HasPrefix(preview, "# Primary database\nHost db1\n") {
+		t.Fatalf("expected: comment and Host, got: %q", preview)
+	}
+	for _, s := range []string{"HostName 10.0.0.1", "ServerAliveInterval 30", "ControlPath ", "LogLevel quiet"} {
+		if !strings.Contains(preview, s) {
+			t.Fatalf("expected: %v in the preview, got: %q", s, preview)
+		}
+	}
+	if strings.Contains(preview, "LocalForward") {
+		t.Fatalf("expected: no forwards to be allocated, got: %q", preview)
+	}
+
+	if preview := previewConnection(nil, pickerItem{Name: "db2"}, nil); preview != "# db2\n" {
+		t.Fatalf("expected: only the comment, got: %q", preview)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/config"
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+const syncConfigHeader = `# Managed by ssh_ms sync-config, any changes will be overwritten
+# Add "Include %s" to the top of ~/.ssh/config to use these connections
+`
+
+// syncConfigPath is the destination for sync-config
+var syncConfigPath = filepath.Join("~", ".ssh", "ssh_ms.conf")
+
+// renderSyncConfig produces an ssh_config for the connections, without
+// allocating ports for their forwards
+// connections : connection data, keyed by the host alias
+// path : destination of the file, used in the header
+func renderSyncConfig(connections map[string]map[string]interface{}, path string) string {
+	b := bytes.Buffer{}
+	fmt.Fprintf(&b, syncConfigHeader, path)
+
+	for _, key := range slices.Sorted(maps.Keys(connections)) {
+		data := connections[key]
+		sshClient := ssh.Connection{}
+		if err := sshClient.RenderConnection(data, key, cfg.User); err != nil {
+			log.Warningf("Skipping '%v': %v", key, err)
+			continue
+		}
+
+		comment := key
+		if val, ok := data["ConfigComment"]; ok && fmt.Sprintf("%v", val) != "" {
+			comment = fmt.Sprintf("%v", val)
+		}
+
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, "#", strings.ReplaceAll(comment, "\n", " "))
+		fmt.Fprint(&b, sshClient.Cache.Config)
+	}
+	return b.String()
+}
+
+// writeIfChanged only replaces the file when the content differs
+// path : destination of the file
+// content : the desired content
+func writeIfChanged(path string, content string) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == content {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
+
+// syncConfig writes all available connections to a single ssh_config file
+// vc : Vault client
+func syncConfig(vc *vaultApi.Client) bool {
+	log.Debugf("syncConfig: %v", syncConfigPath)
+	currentCommand = "sync-config"
+	ignore := regexp.MustCompile("^" + LockPrefix + ".*")
+	connections := map[string]map[string]interface{}{}
+
+	forEachNameSpace(func(ns string) {
+		names, err := getConnections(vc)
+		if err != nil {
+			log.Infof("No connections found in %v: %v", ns, err)
+			return
+		}
+
+		for _, name := range names {
+			if ignore.MatchString(name) {
+				continue
+			}
+			if _, ok := connections[name]; ok {
+				log.Warningf("Skipping '%v' from %v, already provided by another namespace", name, ns)
+				continue
+			}
+			if data := lookupConnection(vc, name); data != nil {
+				connections[name] = data
+			}
+		}
+	})
+
+	path := config.NormalizePath(syncConfigPath)
+	content := renderSyncConfig(connections, path)
+
+	if cfg.Simulate {
+		fmt.Print(content)
+		return true
+	}
+
+	changed, err := writeIfChanged(path, content)
+	if err != nil {
+		log.Errorf("Failed to write '%v': %v", path, err)
+		return false
+	}
+
+	if changed {
+		fmt.Printf("Wrote %d connections to %s\n", len(connections), path)
+	} else {
+		fmt.Printf("%s is up to date\n", path)
+	}
+	return true
+}
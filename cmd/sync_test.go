@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSyncConfig(t *testing.T) {
+	storagePath := cfg.StoragePath
+	defer func() { cfg.StoragePath = storagePath }()
+	cfg.StoragePath = t.TempDir()
+
+	path := filepath.Join(t.TempDir(), "ssh_ms.conf")
+	connections := map[string]map[string]interface{}{
+		"zulu":  {"HostName": "10.0.0.2", "ConfigComment": "Last", "Forwards": "mysql:3306"},
+		"alpha": {"HostName": "10.0.0.1"},
+	}
+
+	content := renderSyncConfig(connections, path)
+	if !strings.Contains(content, "Include "+path) {
+		t.Fatalf("expected: header with include instructions, got: %v", content)
+	}
+	if a, z := strings.Index(content, "Host alpha"), strings.Index(content, "Host zulu"); a < 0 || z < a {
+		t.Fatalf("expected: sorted Host entries, got: %v", content)
+	}
+	if !strings.Contains(content, "# Last\nHost zulu") {
+		t.Fatalf("expected: comment above zulu, got: %v", content)
+	}
+	if files, err := os.ReadDir(cfg.StoragePath); err != nil || len(files) != 0 {
+		t.Fatalf("expected: no forwards to be saved, got: %v, %v", files, err)
+	}
+
+	if changed, err := writeIfChanged(path, content); err != nil || !changed {
+		t.Fatalf("expected: initial write, got: %v, %v", changed, err)
+	}
+	if changed, err := writeIfChanged(path, content); err != nil || changed {
+		t.Fatalf("expected: no change, got: %v, %v", changed, err)
+	}
+	if changed, err := writeIfChanged(path, content+"\n"); err != nil || !changed {
+		t.Fatalf("expected: rewrite, got: %v, %v", changed, err)
+	}
+
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("expected: 0600 permissions, got: %v, %v", fi, err)
+	}
+}
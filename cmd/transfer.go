@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	vaultApi "github.com/hashicorp/vault/api"
+
+	"github.com/cezmunsta/ssh_ms/log"
+	"github.com/cezmunsta/ssh_ms/ssh"
+)
+
+// splitTransferArg separates CONNECTION:path, with a slash before the
+// colon indicating a local path, as is the case for scp, unless it is a
+// connection using the full path of a namespace. The connection can also
+// include the namespace, e.g. namespace:name:path
+// arg : the argument to split
+func splitTransferArg(arg string) (string, string, bool) {
+	if strings.HasPrefix(arg, "-") {
+		return "", arg, false
+	}
+
+	idx := strings.Index(arg, ":")
+	if idx <= 0 {
+		return "", arg, false
+	}
+
+	name := arg[:idx]
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		if !slices.Contains(strings.Split(cfg.SecretPath, ","), name[:i]) {
+			return "", arg, false
+		}
+	} else if next := strings.Index(arg[idx+1:], ":"); next >= 0 && matchNameSpace(name) != "" {
+		idx += next + 1
+		name = arg[:idx]
+	}
+	return name, arg[idx+1:], true
+}
+
+// getTransferConnection returns the connection used in the arguments
+// args : the arguments for the transfer
+func getTransferConnection(args []string) (string, error) {
+	key := ""
+
+	for _, arg := range args {
+		name, _, ok := splitTransferArg(arg)
+		if !ok {
+			continue
+		}
+		if key != "" && name != key {
+			return "", fmt.Errorf("only one connection can be used, found %s and %s", key, name)
+		}
+		key = name
+	}
+
+	if key == "" {
+		return "", fmt.Errorf("expected at least one CONNECTION:path argument")
+	}
+	return key, nil
+}
+
+// rewriteTransferArgs replaces the connection with the host
+// args : the arguments for the transfer
+// host : the destination for the connection
+func rewriteTransferArgs(args []string, host string) []string {
+	rewritten := []string{}
+
+	for _, arg := range args {
+		if _, path, ok := splitTransferArg(arg); ok {
+			arg = host + ":" + path
+		}
+		rewritten = append(rewritten, arg)
+	}
+	return rewritten
+}
+
+// prepareTransfer resolves the connection used for a transfer
+// vc : Vault client
+// key : the connection
+func prepareTransfer(vc *vaultApi.Client, key string) (ssh.Connection, bool) {
+	_, sshClient, _, _ := prepareConnection(vc, []string{key})
+	if sshClient.HostName == "" {
+		log.Errorf("Unable to find connection '%v'", key)
+		return sshClient, false
+	}
+	return sshClient, true
+}
+
+// transferFiles copies files using scp or rsync
+// vc : Vault client
+// command : either scp or rsync
+// args : the arguments for the command, using CONNECTION:path for remote paths
+func transferFiles(vc *vaultApi.Client, command string, args []string) bool {
+	log.Debugf("transferFiles: %v %v", command, args)
+	currentCommand = command
+
+	key, err := getTransferConnection(args)
+	if err != nil {
+		log.Error(err)
+		return false
+	}
+
+	sshClient, ok := prepareTransfer(vc, key)
+	if !ok {
+		return false
+	}
+
+	var cmdArgs []string
+	switch command {
+	case "rsync":
+		cmdArgs = []string{"-e", sshClient.RsyncShell()}
+	default:
+		cmdArgs = sshClient.TransferOptions()
+	}
+
+	ssh.Run(command, append(cmdArgs, rewriteTransferArgs(args, sshClient.TransferHost())...), ssh.UserEnv{User: cfg.User, Simulate: cfg.Simulate})
+	return true
+}
+
+// sftpConnection starts an interactive sftp session
+// vc : Vault client
+// args : CONNECTION[:path], optionally preceded by arguments for sftp
+func sftpConnection(vc *vaultApi.Client, args []string) bool {
+	log.Debugf("sftpConnection: %v", args)
+	currentCommand = "sftp"
+
+	target := args[len(args)-1]
+	key, path, remote := splitTransferArg(target)
+	if !remote || matchNameSpace(key) != "" {
+		key, remote = target, false
+	}
+
+	sshClient, ok := prepareTransfer(vc, key)
+	if !ok {
+		return false
+	}
+
+	dest := sshClient.TransferHost()
+	if remote {
+		dest += ":" + path
+	}
+
+	cmdArgs := append(sshClient.TransferOptions(), args[:len(args)-1]...)
+	ssh.Run("sftp", append(cmdArgs, dest), ssh.UserEnv{User: cfg.User, Simulate: cfg.Simulate})
+	return true
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTransferArgs(t *testing.T) {
+	secretPath := cfg.SecretPath
+	defer func() { cfg.SecretPath = secretPath }()
+	cfg.SecretPath = "secret/ssh_ms,secret/other"
+
+	for arg, expected := range map[string][]string{
+		"gateway:/var/log":          {"gateway", "/var/log"},
+		"gateway:":                  {"gateway", ""},
+		"./local:file":              {"", "./local:file"},
+		"/tmp/file":                 {"", "/tmp/file"},
+		"-r":                        {"", "-r"},
+		"other:gateway:/etc":        {"other:gateway", "/etc"},
+		"secret/other/gateway:/etc": {"secret/other/gateway", "/etc"},
+	} {
+		name, path, _ := splitTransferArg(arg)
+		if name != expected[0] || path != expected[1] {
+			t.Fatalf("expected: %v got: %v, %v", expected, name, path)
+		}
+	}
+
+	if key, err := getTransferConnection([]string{"-r", "gateway:/etc", "./etc"}); err != nil || key != "gateway" {
+		t.Fatalf("expected: gateway got: %v (%v)", key, err)
+	}
+	if _, err := getTransferConnection([]string{"one:/etc", "two:/etc"}); err == nil {
+		t.Fatal("expected: an error for multiple connections")
+	}
+	if _, err := getTransferConnection([]string{"./a", "./b"}); err == nil {
+		t.Fatal("expected: an error without a connection")
+	}
+
+	args := rewriteTransferArgs([]string{"-r", "gateway:/etc", "./etc"}, "[fd00::1]")
+	if !slices.Equal(args, []string{"-r", "[fd00::1]:/etc", "./etc"}) {
+		t.Fatalf("expected: host to replace the connection got: %v", args)
+	}
+}
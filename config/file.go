@@ -0,0 +1,193 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	vaultApi "github.com/hashicorp/vault/api"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvConfigFile is used to change the location of the config file
+	EnvConfigFile = "SSH_MS_CONFIG"
+	// EnvProfile is used to select a profile from the config file
+	EnvProfile = "SSH_MS_PROFILE"
+)
+
+// Profile contains the settings that can be provided by the config file,
+// either as the defaults or as a named profile
+type Profile struct {
+	VaultAddr           string            `yaml:"vault_addr"`
+	NameSpaces          []string          `yaml:"namespaces"`
+	IdentityFile        string            `yaml:"identity_file"`
+	ServiceMap          map[string]string `yaml:"service_map"`
+	StoragePath         string            `yaml:"storage_path"`
+	UndesiredInterfaces []string          `yaml:"undesired_interfaces"`
+}
+
+// File is the runtime config file, the settings at the top level apply to
+// all of the profiles, which can override them
+type File struct {
+	Profile        `yaml:",inline"`
+	DefaultProfile string             `yaml:"profile"`
+	Profiles       map[string]Profile `yaml:"profiles"`
+}
+
+// merge produces a profile using the settings from p in place of those in base
+// p : the settings to apply
+func (base Profile) merge(p Profile) Profile {
+	if p.VaultAddr != "" {
+		base.VaultAddr = p.VaultAddr
+	}
+	if len(p.NameSpaces) > 0 {
+		base.NameSpaces = p.NameSpaces
+	}
+	if p.IdentityFile != "" {
+		base.IdentityFile = p.IdentityFile
+	}
+	if len(p.ServiceMap) > 0 {
+		base.ServiceMap = p.ServiceMap
+	}
+	if p.StoragePath != "" {
+		base.StoragePath = p.StoragePath
+	}
+	if len(p.UndesiredInterfaces) > 0 {
+		base.UndesiredInterfaces = p.UndesiredInterfaces
+	}
+	return base
+}
+
+// GetConfigFilePath returns the location of the config file, which is
+// ~/.config/ssh_ms/config.yaml unless changed using SSH_MS_CONFIG
+func GetConfigFilePath() string {
+	if v := os.Getenv(EnvConfigFile); v != "" {
+		return NormalizePath(v)
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "ssh_ms", "config.yaml")
+}
+
+// ReadConfigFile loads the config file, a missing file is treated as empty
+// path : the location of the file
+func ReadConfigFile(path string) (File, error) {
+	var f File
+
+	fh, err := os.Open(NormalizePath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return f, err
+	}
+	defer fh.Close()
+
+	dec := yaml.NewDecoder(fh)
+	dec.KnownFields(true)
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return f, fmt.Errorf("invalid config file '%s': %w", path, err)
+	}
+	return f, nil
+}
+
+// GetProfile returns the settings for a profile, combined with those at
+// the top level of the file
+// name : the profile, or empty for the default profile
+func (f File) GetProfile(name string) (Profile, error) {
+	if name == "" {
+		name = f.DefaultProfile
+	}
+	if name == "" {
+		return f.Profile, nil
+	}
+
+	p, ok := f.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile '%s', expected one of: %s", name, strings.Join(slices.Sorted(maps.Keys(f.Profiles)), ", "))
+	}
+	return f.Profile.merge(p), nil
+}
+
+// ApplyProfile updates the settings from the build defaults, the config
+// file and then the environment, with each taking precedence over the last
+// name : the profile, or empty for the default profile
+func (s *Settings) ApplyProfile(name string) error {
+	f, err := ReadConfigFile(s.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	p, err := f.GetProfile(name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = f.DefaultProfile
+	}
+
+	services := serviceMap
+	if len(p.ServiceMap) > 0 {
+		services = make(map[string]Service)
+		for _, k := range slices.Sorted(maps.Keys(p.ServiceMap)) {
+			svc, err := ParseService(k, p.ServiceMap[k])
+			if err != nil {
+				return fmt.Errorf("invalid service map in '%s': %w", s.ConfigFile, err)
+			}
+			services[k] = svc
+		}
+	}
+	p = Profile{
+		VaultAddr:           EnvVaultAddr,
+		NameSpaces:          strings.Split(SecretPath, ","),
+		IdentityFile:        EnvSSHIdentityFile,
+		StoragePath:         EnvBasePath,
+		UndesiredInterfaces: undesiredInterfaceNames,
+	}.merge(p)
+
+	s.Profile = name
+	s.EnvVaultAddr = p.VaultAddr
+	s.SecretPath = strings.Join(p.NameSpaces, ",")
+	s.EnvSSHIdentityFile = p.IdentityFile
+	s.ServiceMap = services
+	s.StoragePath = NormalizePath(p.StoragePath)
+	s.UndesiredInterfaces = p.UndesiredInterfaces
+
+	if _, err := ensureDirExists(s.StoragePath); err != nil {
+		return err
+	}
+	return s.applyEnv()
+}
+
+// applyEnv updates the settings that can be set in the environment
+func (s *Settings) applyEnv() error {
+	if v := os.Getenv(vaultApi.EnvVaultAddress); v != "" {
+		s.EnvVaultAddr = v
+	}
+
+	if v := os.Getenv("SSH_MS_SERVICE_MAP"); v != "" {
+		services, errs := ParseServices(v, ";")
+		if len(errs) > 0 {
+			return fmt.Errorf("invalid service map: %v", errs)
+		}
+		s.ServiceMap = services
+	}
+
+	if v := os.Getenv("SSH_MS_SERVICE_MAP_DISABLED"); v == "1" {
+		s.ServiceMap = make(map[string]Service)
+	}
+
+	userByPass := os.Getenv("SSH_MS_BYPASS_INTERFACE_CHECK")
+	if userByPass == "1" || userByPass == "yes" || userByPass == "true" {
+		s.UndesiredInterfaces = []string{}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testConfigFile = `
+vault_addr: https://vault.example.com:8200
+namespaces:
+  - secret/ssh_ms
+service_map:
+  NGINX: "443"
+profiles:
+  acme:
+    vault_addr: https://vault.acme.com:8200
+    namespaces:
+      - secret/acme
+      - secret/shared
+    identity_file: ~/.ssh/acme_ed25519
+    service_map:
+      PMM: https://:8443/graph
+`
+
+func writeConfigFile(t *testing.T, text string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(text), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	f, err := ReadConfigFile(writeConfigFile(t, testConfigFile))
+	if err != nil {
+		t.Fatalf("expected: a config file got: %v", err)
+	}
+
+	if p, err := f.GetProfile(""); err != nil || p.VaultAddr != "https://vault.example.com:8200" {
+		t.Fatalf("expected: the top level settings got: %v (%v)", p, err)
+	}
+
+	p, err := f.GetProfile("acme")
+	if err != nil {
+		t.Fatalf("expected: the acme profile got: %v", err)
+	}
+	if p.VaultAddr != "https://vault.acme.com:8200" || len(p.NameSpaces) != 2 || p.ServiceMap["PMM"] == "" {
+		t.Fatalf("expected: the profile to override the top level settings got: %v", p)
+	}
+
+	if _, err := f.GetProfile("missing"); err == nil {
+		t.Fatal("expected: an error for an unknown profile")
+	}
+
+	if _, err := ReadConfigFile(writeConfigFile(t, "vault_address: typo\n")); err == nil {
+		t.Fatal("expected: an error for an unknown setting")
+	}
+	if _, err := ReadConfigFile(filepath.Join(t.TempDir(), "missing.yaml")); err != nil {
+		t.Fatalf("expected: a missing file to be ignored got: %v", err)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("SSH_MS_SERVICE_MAP", "")
+	t.Setenv("SSH_MS_SERVICE_MAP_DISABLED", "")
+
+	s := Settings{ConfigFile: writeConfigFile(t, testConfigFile+"    storage_path: "+t.TempDir()+"\n")}
+	if err := s.ApplyProfile("acme"); err != nil {
+		t.Fatalf("expected: the acme profile got: %v", err)
+	}
+	if s.Profile != "acme" || s.SecretPath != "secret/acme,secret/shared" || s.EnvSSHIdentityFile != "~/.ssh/acme_ed25519" {
+		t.Fatalf("expected: the settings from the acme profile got: %v", s.ToJSON())
+	}
+	if svc, ok := s.ServiceMap["PMM"]; !ok || svc.Port != 8443 || len(s.ServiceMap) != 1 {
+		t.Fatalf("expected: the service map from the acme profile got: %v", s.ServiceMap)
+	}
+
+	// The environment takes precedence over the config file
+	t.Setenv("VAULT_ADDR", "https://127.0.0.1:8200")
+	if err := s.ApplyProfile("acme"); err != nil || s.EnvVaultAddr != "https://127.0.0.1:8200" {
+		t.Fatalf("expected: VAULT_ADDR to override the profile got: %v (%v)", s.EnvVaultAddr, err)
+	}
+
+	// The requested profile is kept so that the error can be reported later
+	s.Profile = "missing"
+	if err := s.ApplyProfile(s.Profile); err == nil || s.Profile != "missing" {
+		t.Fatalf("expected: an error for an unknown profile got: %v (%v)", s.Profile, err)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RemoteForward stores the reverse port-forwarding details
+type RemoteForward struct {
+	RemotePort uint16
+	LocalPort  uint16
+	LocalHost  string
+	BindHost   string
+}
+
+// String produces the forwarding specification used by ssh -R
+func (rf RemoteForward) String() string {
+	spec := fmt.Sprintf("%d:%s:%d", rf.RemotePort, rf.LocalHost, rf.LocalPort)
+	if rf.BindHost != "" {
+		spec = rf.BindHost + ":" + spec
+	}
+	return spec
+}
+
+// ParseRemoteForward converts a specification into a RemoteForward,
+// accepting either [bind_address:]port:host:hostport or the ssh_config
+// format of [bind_address:]port host:hostport
+// spec : the forwarding specification
+func ParseRemoteForward(spec string) (RemoteForward, error) {
+	rf := RemoteForward{}
+	parts := strings.Split(strings.Join(strings.Fields(spec), ":"), ":")
+
+	if len(parts) == 4 {
+		rf.BindHost = parts[0]
+		parts = parts[1:]
+	} else if len(parts) != 3 {
+		return rf, fmt.Errorf("invalid RemoteForward '%s', expected [bind_address:]port:host:hostport", spec)
+	}
+
+	rp, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return rf, fmt.Errorf("invalid remote port in RemoteForward '%s': %w", spec, err)
+	}
+	lp, err := strconv.ParseUint(parts[2], 10, 16)
+	if err != nil {
+		return rf, fmt.Errorf("invalid local port in RemoteForward '%s': %w", spec, err)
+	}
+
+	rf.RemotePort = uint16(rp)
+	rf.LocalHost = parts[1]
+	rf.LocalPort = uint16(lp)
+	return rf, nil
+}
@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestParseRemoteForward(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"9000:localhost:8080":           "9000:localhost:8080",
+		"0.0.0.0:9000:127.0.0.1:8080":   "0.0.0.0:9000:127.0.0.1:8080",
+		"9000 localhost:8080":           "9000:localhost:8080",
+		"127.0.0.1:9000 localhost:8080": "127.0.0.1:9000:localhost:8080",
+	} {
+		rf, err := ParseRemoteForward(spec)
+		if err != nil || rf.String() != expected {
+			t.Fatalf("expected: %v, got: %v, %v", expected, rf, err)
+		}
+	}
+
+	for _, spec := range []string{"9000", "9000:localhost", "x:localhost:8080", "9000:localhost:99999"} {
+		if rf, err := ParseRemoteForward(spec); err == nil {
+			t.Fatalf("expected: an error for %v, got: %v", spec, rf)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// KeywordType describes the values accepted for a keyword
+type KeywordType int
+
+// Types of value for keywords
+const (
+	KeywordString KeywordType = iota
+	KeywordFlag
+	KeywordNumber
+	KeywordPort
+	KeywordChoice
+	KeywordTime
+	KeywordTags
+	KeywordRemoteForward
+	KeywordForwards
+)
+
+// Keyword describes an option that can be stored for a connection
+type Keyword struct {
+	Name    string
+	Type    KeywordType
+	Choices []string
+	// Internal keywords are used by ssh_ms and are not passed to ssh
+	Internal bool
+}
+
+var (
+	timeRegex = regexp.MustCompile(`^([0-9]+[smhdwSMHDW]?)+$`)
+
+	flagChoices = []string{"yes", "no"}
+
+	// keywords catalogues the OpenSSH client options, see ssh_config(5),
+	// along with the options used internally, keyed by the lowercase name
+	keywords = map[string]Keyword{}
+
+	// keywordAliases maps alternative names onto a keyword
+	keywordAliases = map[string]string{
+		// X11Forwarding is the name used by sshd
+		"x11forwarding": "ForwardX11",
+	}
+)
+
+func init() {
+	for _, k := range []Keyword{
+		// Internal options
+		{Name: "Cache", Internal: true},
+		{Name: "ConfigComment", Internal: true},
+		{Name: "ConfigMotd", Internal: true},
+		{Name: "Expires", Internal: true},
+		{Name: "Forwards", Type: KeywordForwards, Internal: true},
+		{Name: "ModifiedBy", Internal: true},
+		{Name: "SocksDomains", Internal: true},
+		{Name: "Tags", Type: KeywordTags, Internal: true},
+
+		// OpenSSH client options
+		{Name: "AddKeysToAgent"},
+		{Name: "AddressFamily", Type: KeywordChoice, Choices: []string{"any", "inet", "inet6"}},
+		{Name: "BatchMode", Type: KeywordFlag},
+		{Name: "BindAddress"},
+		{Name: "BindInterface"},
+		{Name: "CanonicalDomains"},
+		{Name: "CanonicalizeFallbackLocal", Type: KeywordFlag},
+		{Name: "CanonicalizeHostname", Type: KeywordChoice, Choices: []string{"yes", "no", "always", "none"}},
+		{Name: "CanonicalizeMaxDots", Type: KeywordNumber},
+		{Name: "CanonicalizePermittedCNAMEs"},
+		{Name: "CASignatureAlgorithms"},
+		{Name: "CertificateFile"},
+		{Name: "ChannelTimeout"},
+		{Name: "CheckHostIP", Type: KeywordFlag},
+		{Name: "Ciphers"},
+		{Name: "ClearAllForwardings", Type: KeywordFlag},
+		{Name: "Compression", Type: KeywordFlag},
+		{Name: "ConnectionAttempts", Type: KeywordNumber},
+		{Name: "ConnectTimeout", Type: KeywordNumber},
+		{Name: "ControlMaster", Type: KeywordChoice, Choices: []string{"yes", "no", "ask", "auto", "autoask"}},
+		{Name: "ControlPath"},
+		{Name: "ControlPersist", Type: KeywordTime, Choices: flagChoices},
+		{Name: "DynamicForward"},
+		{Name: "EnableEscapeCommandline", Type: KeywordFlag},
+		{Name: "EnableSSHKeysign", Type: KeywordFlag},
+		{Name: "EscapeChar"},
+		{Name: "ExitOnForwardFailure", Type: KeywordFlag},
+		{Name: "FingerprintHash", Type: KeywordChoice, Choices: []string{"md5", "sha256"}},
+		{Name: "ForkAfterAuthentication", Type: KeywordFlag},
+		{Name: "ForwardAgent"},
+		{Name: "ForwardX11", Type: KeywordFlag},
+		{Name: "ForwardX11Timeout", Type: KeywordTime},
+		{Name: "ForwardX11Trusted", Type: KeywordFlag},
+		{Name: "GatewayPorts", Type: KeywordFlag},
+		{Name: "GlobalKnownHostsFile"},
+		{Name: "GSSAPIAuthentication", Type: KeywordFlag},
+		{Name: "GSSAPIDelegateCredentials", Type: KeywordFlag},
+		{Name: "HashKnownHosts", Type: KeywordFlag},
+		{Name: "HostbasedAcceptedAlgorithms"},
+		{Name: "HostbasedAuthentication", Type: KeywordFlag},
+		{Name: "HostKeyAlgorithms"},
+		{Name: "HostKeyAlias"},
+		{Name: "HostName"},
+		{Name: "IdentitiesOnly", Type: KeywordFlag},
+		{Name: "IdentityAgent"},
+		{Name: "IdentityFile"},
+		{Name: "IgnoreUnknown"},
+		{Name: "IPQoS"},
+		{Name: "KbdInteractiveAuthentication", Type: KeywordFlag},
+		{Name: "KbdInteractiveDevices"},
+		{Name: "KexAlgorithms"},
+		{Name: "KnownHostsCommand"},
+		{Name: "LocalCommand"},
+		{Name: "LocalForward"},
+		{Name: "LogLevel", Type: KeywordChoice, Choices: []string{"quiet", "fatal", "error", "info", "verbose", "debug", "debug1", "debug2", "debug3"}},
+		{Name: "LogVerbose"},
+		{Name: "MACs"},
+		{Name: "NoHostAuthenticationForLocalhost", Type: KeywordFlag},
+		{Name: "NumberOfPasswordPrompts", Type: KeywordNumber},
+		{Name: "PasswordAuthentication", Type: KeywordFlag},
+		{Name: "PermitLocalCommand", Type: KeywordFlag},
+		{Name: "PermitRemoteOpen"},
+		{Name: "PKCS11Provider"},
+		{Name: "Port", Type: KeywordPort},
+		{Name: "PreferredAuthentications"},
+		{Name: "ProxyCommand"},
+		{Name: "ProxyJump"},
+		{Name: "ProxyUseFdpass", Type: KeywordFlag},
+		{Name: "PubkeyAcceptedAlgorithms"},
+		{Name: "PubkeyAuthentication", Type: KeywordChoice, Choices: []string{"yes", "no", "unbound", "host-bound"}},
+		{Name: "RekeyLimit"},
+		{Name: "RemoteCommand"},
+		{Name: "RemoteForward", Type: KeywordRemoteForward},
+		{Name: "RequestTTY", Type: KeywordChoice, Choices: []string{"yes", "no", "force", "auto"}},
+		{Name: "RequiredRSASize", Type: KeywordNumber},
+		{Name: "RevokedHostKeys"},
+		{Name: "SecurityKeyProvider"},
+		{Name: "SendEnv"},
+		{Name: "ServerAliveCountMax", Type: KeywordNumber},
+		{Name: "ServerAliveInterval", Type: KeywordNumber},
+		{Name: "SessionType", Type: KeywordChoice, Choices: []string{"none", "subsystem", "default"}},
+		{Name: "SetEnv"},
+		{Name: "StdinNull", Type: KeywordFlag},
+		{Name: "StreamLocalBindMask"},
+		{Name: "StreamLocalBindUnlink", Type: KeywordFlag},
+		{Name: "StrictHostKeyChecking", Type: KeywordChoice, Choices: []string{"yes", "no", "ask", "accept-new", "off"}},
+		{Name: "SyslogFacility"},
+		{Name: "Tag"},
+		{Name: "TCPKeepAlive", Type: KeywordFlag},
+		{Name: "Tunnel", Type: KeywordChoice, Choices: []string{"yes", "no", "point-to-point", "ethernet"}},
+		{Name: "TunnelDevice"},
+		{Name: "UpdateHostKeys", Type: KeywordChoice, Choices: []string{"yes", "no", "ask"}},
+		{Name: "User"},
+		{Name: "UserKnownHostsFile"},
+		{Name: "VerifyHostKeyDNS", Type: KeywordChoice, Choices: []string{"yes", "no", "ask"}},
+		{Name: "VisualHostKey", Type: KeywordFlag},
+		{Name: "XAuthLocation"},
+	} {
+		if k.Type == KeywordFlag {
+			k.Choices = flagChoices
+		}
+		keywords[strings.ToLower(k.Name)] = k
+	}
+}
+
+// LookupKeyword returns the catalogue entry for an option
+// name : the option name, matched case-insensitively
+func LookupKeyword(name string) (Keyword, bool) {
+	name = strings.ToLower(name)
+	if alias, ok := keywordAliases[name]; ok {
+		name = strings.ToLower(alias)
+	}
+	k, ok := keywords[name]
+	return k, ok
+}
+
+// Validate checks that a value is acceptable for the keyword
+// value : the value to check
+func (k Keyword) Validate(value string) error {
+	v := strings.ToLower(strings.TrimSpace(value))
+
+	switch k.Type {
+	case KeywordFlag, KeywordChoice:
+		if slices.Contains(k.Choices, v) {
+			return nil
+		}
+		return fmt.Errorf("invalid value for %s (%s), expected one of: %s", k.Name, value, strings.Join(k.Choices, ", "))
+	case KeywordNumber:
+		if _, err := strconv.ParseUint(v, 10, 32); err != nil {
+			return fmt.Errorf("invalid value for %s (%s), expected a number", k.Name, value)
+		}
+	case KeywordPort:
+		if _, err := strconv.ParseUint(v, 10, 16); err != nil {
+			return fmt.Errorf("invalid value for %s (%s), expected a port", k.Name, value)
+		}
+	case KeywordTime:
+		if !slices.Contains(k.Choices, v) && !timeRegex.MatchString(v) {
+			return fmt.Errorf("invalid value for %s (%s), expected a time, e.g. 90, 10m or 1h30m", k.Name, value)
+		}
+	case KeywordTags:
+		if _, err := ParseTags(value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", k.Name, err)
+		}
+	case KeywordRemoteForward:
+		for _, spec := range strings.Split(value, ",") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			if _, err := ParseRemoteForward(spec); err != nil {
+				return err
+			}
+		}
+	case KeywordForwards:
+		if _, errs := ParseServices(value, ","); len(errs) > 0 {
+			return fmt.Errorf("invalid value for %s: %w", k.Name, errs[0])
+		}
+	}
+	return nil
+}
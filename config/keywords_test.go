@@ -0,0 +1,61 @@
+package config
+
+import "testing"
+
+func TestLookupKeyword(t *testing.T) {
+	for name, expected := range map[string]string{
+		"connecttimeout": "ConnectTimeout",
+		"SETENV":         "SetEnv",
+		"X11Forwarding":  "ForwardX11",
+		"configcomment":  "ConfigComment",
+	} {
+		if k, ok := LookupKeyword(name); !ok || k.Name != expected {
+			t.Fatalf("expected: %v got: %v", expected, k.Name)
+		}
+	}
+
+	if k, ok := LookupKeyword("UseRoaming"); ok {
+		t.Fatalf("expected: UseRoaming to be unknown got: %v", k)
+	}
+}
+
+func TestKeywordValidate(t *testing.T) {
+	valid := map[string][]string{
+		"ConnectTimeout":        {"10"},
+		"StrictHostKeyChecking": {"accept-new", "No"},
+		"LogLevel":              {"DEBUG3", "quiet"},
+		"ControlPersist":        {"yes", "600", "1h30m"},
+		"ForwardX11":            {"yes", "no"},
+		"Port":                  {"2222"},
+		"RemoteCommand":         {"tmux new -A -s main"},
+		"RemoteForward":         {"9000:localhost:8080", "9000 localhost:8080,127.0.0.1:8443:localhost:443"},
+		"Forwards":              {"pmm:443", "pmm:https://127.0.0.1:443,db:tcp://:3306"},
+	}
+	invalid := map[string][]string{
+		"ConnectTimeout":        {"soon", "-1"},
+		"StrictHostKeyChecking": {"maybe"},
+		"LogLevel":              {"LOUD"},
+		"ControlPersist":        {"forever"},
+		"ForwardX11":            {"true"},
+		"Port":                  {"65536"},
+		"RemoteForward":         {"9000", "9000:localhost:8080,invalid"},
+		"Forwards":              {"443", "pmm:https", "pmm:443,db:99999"},
+	}
+
+	for name, values := range valid {
+		k, _ := LookupKeyword(name)
+		for _, v := range values {
+			if err := k.Validate(v); err != nil {
+				t.Fatalf("expected: %s=%s to be valid got: %v", name, v, err)
+			}
+		}
+	}
+	for name, values := range invalid {
+		k, _ := LookupKeyword(name)
+		for _, v := range values {
+			if err := k.Validate(v); err == nil {
+				t.Fatalf("expected: %s=%s to be invalid", name, v)
+			}
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"sync"
 
-	vaultApi "github.com/hashicorp/vault/api"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,8 +16,8 @@ type Settings struct {
 	LogLevel                                                                         logrus.Level
 	Debug, RenewWarningOptOut, Simulate, StoredToken, Verbose, Version, VersionCheck bool
 	ConfigComment, ConfigMotd, EnvSSHDefaultUsername, EnvSSHIdentityFile,
-	CustomLocalForward, EnvSSHUsername, EnvVaultAddr, NameSpace, SecretPath, Show, StoragePath, User, VaultAddr, VaultToken, VaultAPIVersion, VaultSDKVersion string
-	ServiceMap          map[string]string
+	ConfigFile, CustomLocalForward, EnvSSHUsername, EnvVaultAddr, NameSpace, Output, PacFile, Profile, SecretPath, Show, SocksPort, StoragePath, User, VaultAddr, VaultToken, VaultAPIVersion, VaultSDKVersion string
+	ServiceMap          map[string]Service
 	UndesiredInterfaces []string
 }
 
@@ -45,8 +44,8 @@ var (
 	// default value is filepath.Join("~", ".ssh", "id_ed25519")
 	EnvSSHIdentityFile string
 
-	// EnvVaultAddr is the default location for Vault,
-	// default value is os.Getenv(vaultApi.EnvVaultAddress)
+	// EnvVaultAddr is the default location for Vault, which can be
+	// overridden by the config file and then os.Getenv(vaultApi.EnvVaultAddress)
 	EnvVaultAddr string
 
 	// SecretPath is the location used for connection manangement
@@ -55,36 +54,18 @@ var (
 	portServiceMappings string
 	undesiredInterfaces string
 
-	serviceMap              = make(map[string]string)
+	serviceMap              = make(map[string]Service)
 	undesiredInterfaceNames = []string{}
 )
 
 func init() {
-	if v := os.Getenv("SSH_MS_SERVICE_MAP"); v != "" {
-		portServiceMappings = v
-	}
-
-	if v := os.Getenv("SSH_MS_SERVICE_MAP_DISABLED"); v == "1" {
-		portServiceMappings = ""
-	}
-
 	if len(portServiceMappings) > 0 {
-		for _, m := range strings.Split(portServiceMappings, ";") {
-			p := strings.Split(m, ":")
-
-			if len(p) != 2 {
-				panic(fmt.Sprintf("Expected 2 items, got %d: %v", len(p), p))
-			}
-
-			serviceMap[p[0]] = p[1]
+		var errs []error
+		if serviceMap, errs = ParseServices(portServiceMappings, ";"); len(errs) > 0 {
+			panic(fmt.Sprintf("Invalid service map: %v", errs))
 		}
 	}
 
-	userByPass := os.Getenv("SSH_MS_BYPASS_INTERFACE_CHECK")
-	if userByPass == "1" || userByPass == "yes" || userByPass == "true" {
-		undesiredInterfaces = ""
-	}
-
 	if len(undesiredInterfaces) > 0 {
 		undesiredInterfaceNames = strings.Split(undesiredInterfaces, ",")
 	}
@@ -119,10 +100,6 @@ func GetConfig() *Settings {
 			EnvSSHIdentityFile = filepath.Join("~", ".ssh", "id_ed25519")
 		}
 
-		if EnvVaultAddr == "" {
-			EnvVaultAddr = os.Getenv(vaultApi.EnvVaultAddress)
-		}
-
 		EnvRenewWarningOptOut = os.Getenv("SSH_MS_RENEW_WARNING_OPTOUT")
 		if EnvRenewWarningOptOut == "1" || EnvRenewWarningOptOut == "yes" || EnvRenewWarningOptOut == "true" {
 			renewWarningOptOut = true
@@ -130,6 +107,7 @@ func GetConfig() *Settings {
 
 		settings = Settings{
 			ConfigComment:         "",
+			ConfigFile:            GetConfigFilePath(),
 			ConfigMotd:            "",
 			CustomLocalForward:    "",
 			EnvSSHDefaultUsername: EnvSSHDefaultUsername,
@@ -138,6 +116,7 @@ func GetConfig() *Settings {
 			EnvVaultAddr:          EnvVaultAddr,
 			LogLevel:              logrus.WarnLevel,
 			NameSpace:             "",
+			Profile:               os.Getenv(EnvProfile),
 			RenewWarningOptOut:    renewWarningOptOut,
 			SecretPath:            SecretPath,
 			ServiceMap:            serviceMap,
@@ -148,6 +127,11 @@ func GetConfig() *Settings {
 			VaultAPIVersion:       vaultAPIVersion,
 			VaultSDKVersion:       vaultSDKVersion,
 		}
+
+		// Errors are reported once the flags have been parsed and the
+		// profile is applied again, so the requested name is kept even
+		// when it cannot be loaded
+		settings.ApplyProfile(settings.Profile)
 	})
 	return &settings
 }
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultServiceBindHost is the remote host used when forwarding a service
+	DefaultServiceBindHost = "127.0.0.1"
+	// DefaultServiceScheme is used when displaying the URL for a service
+	DefaultServiceScheme = "https"
+)
+
+// Service describes a remote service that is made available via LocalForward
+type Service struct {
+	Name, Scheme, Path, BindHost string
+	Port                         uint16
+}
+
+// ParseService converts a service definition, which is either a port or
+// a URL in the format scheme://[bindhost]:port[/path]
+// name : the name of the service
+// spec : the service definition
+func ParseService(name string, spec string) (Service, error) {
+	svc := Service{
+		Name:     name,
+		Scheme:   DefaultServiceScheme,
+		BindHost: DefaultServiceBindHost,
+	}
+	spec = strings.TrimSpace(spec)
+
+	if !strings.Contains(spec, "://") {
+		port, err := strconv.ParseUint(spec, 10, 16)
+		if err != nil {
+			return svc, fmt.Errorf("invalid port for service '%s': %w", name, err)
+		}
+		svc.Port = uint16(port)
+		return svc, nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return svc, fmt.Errorf("invalid definition for service '%s': %w", name, err)
+	}
+
+	port, err := strconv.ParseUint(u.Port(), 10, 16)
+	if err != nil {
+		return svc, fmt.Errorf("invalid port for service '%s': %w", name, err)
+	}
+	svc.Port = uint16(port)
+	svc.Scheme = u.Scheme
+	svc.Path = u.Path
+
+	if u.Hostname() != "" {
+		svc.BindHost = u.Hostname()
+	}
+	return svc, nil
+}
+
+// ParseServices converts a list of service definitions
+// spec : list of name:definition pairs
+// sep : separator used between pairs
+func ParseServices(spec string, sep string) (map[string]Service, []error) {
+	var errs []error
+	services := map[string]Service{}
+
+	for _, m := range strings.Split(spec, sep) {
+		if strings.TrimSpace(m) == "" {
+			continue
+		}
+
+		name, def, ok := strings.Cut(strings.TrimSpace(m), ":")
+		if !ok || name == "" {
+			errs = append(errs, fmt.Errorf("invalid service '%s', expected name:definition", m))
+			continue
+		}
+
+		svc, err := ParseService(name, def)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		services[name] = svc
+	}
+	return services, errs
+}
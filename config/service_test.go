@@ -0,0 +1,34 @@
+package config
+
+import "testing"
+
+func TestParseService(t *testing.T) {
+	tests := map[string]Service{
+		"443":                       {Name: "test", Scheme: DefaultServiceScheme, BindHost: DefaultServiceBindHost, Port: 443},
+		"https://:8443/graph":       {Name: "test", Scheme: "https", BindHost: DefaultServiceBindHost, Port: 8443, Path: "/graph"},
+		"http://10.0.0.5:3000/d":    {Name: "test", Scheme: "http", BindHost: "10.0.0.5", Port: 3000, Path: "/d"},
+		"postgres://localhost:5432": {Name: "test", Scheme: "postgres", BindHost: "localhost", Port: 5432},
+	}
+
+	for spec, expected := range tests {
+		if svc, err := ParseService("test", spec); err != nil || svc != expected {
+			t.Fatalf("expected: %v got: %v (%v)", expected, svc, err)
+		}
+	}
+
+	for _, spec := range []string{"", "port", "70000", "https://localhost"} {
+		if _, err := ParseService("test", spec); err == nil {
+			t.Fatalf("expected: error for '%s' got: nil", spec)
+		}
+	}
+}
+
+func TestParseServices(t *testing.T) {
+	services, errs := ParseServices("NGINX:443;PMM:https://:8443/graph;;broken", ";")
+	if len(errs) != 1 {
+		t.Fatalf("expected: 1 error got: %v", errs)
+	}
+	if len(services) != 2 || services["NGINX"].Port != 443 || services["PMM"].Path != "/graph" {
+		t.Fatalf("expected: NGINX and PMM got: %v", services)
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// TagSeparator is used between tags when they are stored as a single value
+const TagSeparator = ","
+
+// ParseTag splits a tag in the format key=value
+// spec : the tag
+func ParseTag(spec string) (string, string, error) {
+	key, value, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	key = strings.TrimSpace(key)
+
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid tag '%s', expected key=value", spec)
+	}
+	if strings.Contains(value, TagSeparator) {
+		return "", "", fmt.Errorf("invalid tag '%s', the value cannot contain '%s'", spec, TagSeparator)
+	}
+	return key, strings.TrimSpace(value), nil
+}
+
+// ParseTags converts a list of tags, e.g. env=prod,customer=acme
+// spec : the tags separated by TagSeparator
+func ParseTags(spec string) (map[string]string, error) {
+	tags := map[string]string{}
+
+	for _, t := range strings.Split(spec, TagSeparator) {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		key, value, err := ParseTag(t)
+		if err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// FormatTags converts tags into a list, ordered by key
+// tags : the tags to convert
+func FormatTags(tags map[string]string) string {
+	var list []string
+
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		list = append(list, k+"="+tags[k])
+	}
+	return strings.Join(list, TagSeparator)
+}
+
+// MatchTags checks that every filter is present in the tags
+// tags : the tags for a connection
+// filters : the tags that must match
+func MatchTags(tags map[string]string, filters map[string]string) bool {
+	for k, v := range filters {
+		if tv, ok := tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags(" env=prod, customer = acme,,role=")
+	expected := map[string]string{"env": "prod", "customer": "acme", "role": ""}
+	if err != nil || !maps.Equal(tags, expected) {
+		t.Fatalf("expected: %v got: %v (%v)", expected, tags, err)
+	}
+
+	for _, spec := range []string{"env", "=prod"} {
+		if _, err := ParseTags(spec); err == nil {
+			t.Fatalf("expected: error for '%s' got: nil", spec)
+		}
+	}
+	if _, _, err := ParseTag("env=prod,dev"); err == nil {
+		t.Fatal("expected: error for a value containing the separator")
+	}
+
+	if s := FormatTags(tags); s != "customer=acme,env=prod,role=" {
+		t.Fatalf("expected: tags ordered by key got: %v", s)
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	tags := map[string]string{"env": "prod", "customer": "acme"}
+
+	for filters, expected := range map[string]bool{
+		"":                        true,
+		"env=prod":                true,
+		"env=prod,customer=acme":  true,
+		"env=dev":                 false,
+		"env=prod,customer=other": false,
+		"region=eu":               false,
+	} {
+		f, _ := ParseTags(filters)
+		if m := MatchTags(tags, f); m != expected {
+			t.Fatalf("expected: %v for '%s' got: %v", expected, filters, m)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cezmunsta/ssh_ms/config"
+	"github.com/cezmunsta/ssh_ms/log"
+)
+
+// maxIncludeDepth matches the recursion limit used by OpenSSH
+const maxIncludeDepth = 16
+
+// ConfigOption is a single keyword from an ssh_config file
+type ConfigOption struct {
+	Keyword, Value string
+}
+
+// ConfigEntry is a Host or Match block from an ssh_config file
+type ConfigEntry struct {
+	Hosts   []string
+	Match   string
+	Comment string
+	Options []ConfigOption
+}
+
+// configParser tracks state while reading ssh_config files
+type configParser struct {
+	baseDir string
+	entries []ConfigEntry
+	comment string
+}
+
+// ParseConfig reads Host blocks from an OpenSSH client config file,
+// following any Include directives
+// path : location of the ssh_config file
+func ParseConfig(path string) ([]ConfigEntry, error) {
+	p := configParser{baseDir: filepath.Join(os.Getenv("HOME"), ".ssh")}
+	if err := p.parseFile(config.NormalizePath(path), 0); err != nil {
+		return nil, err
+	}
+	return p.entries, nil
+}
+
+// current returns the block that options are added to, creating a
+// global block for options that appear before the first Host line
+func (p *configParser) current() *ConfigEntry {
+	if len(p.entries) == 0 {
+		p.entries = append(p.entries, ConfigEntry{Hosts: []string{"*"}})
+	}
+	return &p.entries[len(p.entries)-1]
+}
+
+// parseFile reads a single file
+// path : location of the file
+// depth : level of Include recursion
+func (p *configParser) parseFile(path string, depth int) error {
+	log.Debug("parseFile: ", path)
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("maximum Include depth exceeded at '%s'", path)
+	}
+
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			p.comment = ""
+			continue
+		} else if strings.HasPrefix(line, "#") {
+			p.comment = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			continue
+		}
+
+		keyword, value := splitConfigLine(line)
+		switch strings.ToLower(keyword) {
+		case "host":
+			p.entries = append(p.entries, ConfigEntry{Hosts: strings.Fields(value), Comment: p.comment})
+		case "match":
+			p.entries = append(p.entries, ConfigEntry{Match: value, Comment: p.comment})
+		case "include":
+			for _, pattern := range strings.Fields(value) {
+				if err := p.include(pattern, depth); err != nil {
+					return err
+				}
+			}
+		default:
+			entry := p.current()
+			entry.Options = append(entry.Options, ConfigOption{Keyword: keyword, Value: value})
+		}
+		p.comment = ""
+	}
+	return scanner.Err()
+}
+
+// include expands an Include pattern and parses each matching file
+// pattern : the glob pattern, relative to ~/.ssh unless absolute
+// depth : level of Include recursion
+func (p *configParser) include(pattern string, depth int) error {
+	pattern = config.NormalizePath(pattern)
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(p.baseDir, pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid Include pattern '%s': %w", pattern, err)
+	}
+
+	for _, m := range matches {
+		if err := p.parseFile(m, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitConfigLine separates the keyword from the value, which may be
+// delimited by whitespace or an equals sign
+func splitConfigLine(line string) (string, string) {
+	idx := strings.IndexAny(line, " \t=")
+	if idx < 0 {
+		return line, ""
+	}
+
+	keyword := line[:idx]
+	value := strings.TrimSpace(line[idx:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+
+	if len(value) > 1 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	return keyword, value
+}
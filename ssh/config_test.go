@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	dir := t.TempDir()
+	included := filepath.Join(dir, "customers.conf")
+	main := filepath.Join(dir, "config")
+
+	if err := os.WriteFile(included, []byte(`
+# Customer database
+Host db-1
+  HostName 10.0.0.10
+  User=dba
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(main, []byte(`
+ForwardAgent no
+
+# The main gateway
+Host gateway-us-1 gw
+  HostName 192.168.0.1
+  Port 2222
+  IdentityFile "~/.ssh/custom rsa"
+
+Include `+filepath.Join(dir, "*.conf")+`
+
+Match host *.internal
+  User bob
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ParseConfig(main)
+	if err != nil {
+		t.Fatalf("expected: entries, got: %v", err)
+	}
+
+	if len(entries) != 4 {
+		t.Fatalf("expected: 4 entries, got: %v", entries)
+	}
+
+	if entries[0].Hosts[0] != "*" || entries[0].Options[0].Keyword != "ForwardAgent" {
+		t.Fatalf("expected: global ForwardAgent, got: %v", entries[0])
+	}
+
+	gw := entries[1]
+	if len(gw.Hosts) != 2 || gw.Comment != "The main gateway" {
+		t.Fatalf("expected: 2 hosts with a comment, got: %v", gw)
+	}
+	if gw.Options[2].Value != "~/.ssh/custom rsa" {
+		t.Fatalf("expected: unquoted IdentityFile, got: %v", gw.Options[2].Value)
+	}
+
+	db := entries[2]
+	if db.Hosts[0] != "db-1" || db.Options[1].Keyword != "User" || db.Options[1].Value != "dba" {
+		t.Fatalf("expected: included db-1 entry, got: %v", db)
+	}
+
+	if entries[3].Match != "host *.internal" {
+		t.Fatalf("expected: Match block, got: %v", entries[3])
+	}
+
+	if _, err := ParseConfig(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected: an error for a missing file")
+	}
+}
@@ -0,0 +1,162 @@
+package ssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cezmunsta/ssh_ms/config"
+)
+
+// controlDestination is passed to ssh -O, the ControlPath is used to
+// locate the master so the destination is only a placeholder
+const controlDestination = "ssh_ms"
+
+// controlPathRegex matches the names used for a ControlPath by setControlPath
+var controlPathRegex = regexp.MustCompile(`^(cp_.*|[0-9a-f]{40}|%C)$`)
+
+// GetControlPath returns the ControlPath for a connection, without
+// allocating any ports for forwarding
+// args : options provided for inspection
+// templateUser : the username for templated connections
+func GetControlPath(args map[string]interface{}, templateUser string) string {
+	c := Connection{}
+	setUser(&c, args, templateUser)
+	setPort(&c, args)
+	setHostname(&c, args)
+	setControlPath(&c, args)
+	return c.ControlPath
+}
+
+// Control sends a command to the master for a ControlPath using ssh -O
+// controlPath : the socket for the master
+// operation : the control command, e.g. check or exit
+// opts : extra arguments for ssh, e.g. forwarding rules
+func Control(controlPath string, operation string, opts ...string) (string, error) {
+	args := append([]string{"-O", operation, "-o", "ControlPath=" + controlPath}, opts...)
+	out, err := exec.Command("ssh", append(args, controlDestination)...).CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
+
+// ListControlSockets returns the ControlPath sockets present in a directory
+// dir : the directory to search
+func ListControlSockets(dir string) ([]string, error) {
+	var sockets []string
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.Type()&os.ModeSocket != 0 {
+			sockets = append(sockets, filepath.Join(dir, e.Name()))
+		}
+	}
+	return sockets, nil
+}
+
+// IsForwardCache checks whether a file is the forward cache for a ControlPath,
+// which is stored alongside the cached connections
+// path : the file to check
+func IsForwardCache(path string) bool {
+	name, ok := strings.CutSuffix(filepath.Base(path), ".json")
+	return ok && controlPathRegex.MatchString(name)
+}
+
+// ReadForwardCache returns the local ports allocated to a master, keyed
+// by the name of the forward
+// controlPath : the socket for the master
+func ReadForwardCache(controlPath string) (map[string]uint16, error) {
+	var data map[string]interface{}
+	forwards := map[string]uint16{}
+
+	read, err := os.ReadFile(controlPath + ".json")
+	if err != nil {
+		return forwards, err
+	}
+	if err := json.Unmarshal(read, &data); err != nil {
+		return forwards, err
+	}
+
+	for k, v := range data {
+		p, err := strconv.ParseUint(fmt.Sprintf("%v", v), 10, 16)
+		if err != nil {
+			return forwards, fmt.Errorf("invalid port for '%s': %w", k, err)
+		}
+		forwards[k] = uint16(p)
+	}
+	return forwards, nil
+}
+
+// writeForwardCache saves the local ports allocated to a master
+// controlPath : the socket for the master
+// forwards : the local ports, keyed by the name of the forward
+func writeForwardCache(controlPath string, forwards map[string]uint16) error {
+	data := map[string]string{}
+	for k, v := range forwards {
+		data[k] = fmt.Sprintf("%d", v)
+	}
+
+	buff, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(controlPath+".json", buff, 0o640)
+}
+
+// AddForward requests a LocalForward from a running master, using a free
+// local port that is then recorded in the forward cache
+// controlPath : the socket for the master
+// svc : the service to forward
+func AddForward(controlPath string, svc config.Service) (LocalForward, error) {
+	forwards, err := ReadForwardCache(controlPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return LocalForward{}, err
+	}
+	if p, ok := forwards[svc.Name]; ok {
+		return newLocalForward(p, svc), fmt.Errorf("%s is already forwarded to port %d", svc.Name, p)
+	}
+
+	lp, err := acquirePort(localForwardPortMin, localForwardPortMax)
+	if err != nil {
+		return LocalForward{}, err
+	}
+	lf := newLocalForward(lp, svc)
+
+	if out, err := Control(controlPath, "forward", "-L", lf.String()); err != nil {
+		return lf, fmt.Errorf("%w: %s", err, out)
+	}
+	forwards[svc.Name] = lp
+	return lf, writeForwardCache(controlPath, forwards)
+}
+
+// CancelForward removes a LocalForward from a running master, along with
+// its entry in the forward cache
+// controlPath : the socket for the master
+// svc : the forwarded service
+func CancelForward(controlPath string, svc config.Service) (LocalForward, error) {
+	forwards, err := ReadForwardCache(controlPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return LocalForward{}, err
+	}
+
+	p, ok := forwards[svc.Name]
+	if !ok {
+		return LocalForward{}, fmt.Errorf("%s is not forwarded", svc.Name)
+	}
+	lf := newLocalForward(p, svc)
+
+	if out, err := Control(controlPath, "cancel", "-L", lf.String()); err != nil {
+		return lf, fmt.Errorf("%w: %s", err, out)
+	}
+	delete(forwards, svc.Name)
+	return lf, writeForwardCache(controlPath, forwards)
+}
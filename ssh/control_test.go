@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListControlSockets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cp_test")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unable to create socket: %v", err)
+	}
+	defer l.Close()
+
+	if err := os.WriteFile(path+".json", []byte(`{"mysql":"18000"}`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	if sockets, err := ListControlSockets(dir); err != nil || len(sockets) != 1 || sockets[0] != path {
+		t.Fatalf("expected: [%v] got: %v (%v)", path, sockets, err)
+	}
+}
+
+func TestForwardCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cp_test")
+
+	if _, err := ReadForwardCache(path); err == nil {
+		t.Fatal("expected: an error for a missing cache")
+	}
+
+	if err := writeForwardCache(path, map[string]uint16{"mysql": 18000, "grafana": 18001}); err != nil {
+		t.Fatal(err)
+	}
+	if forwards, err := ReadForwardCache(path); err != nil || len(forwards) != 2 || forwards["grafana"] != 18001 {
+		t.Fatalf("expected: mysql and grafana got: %v (%v)", forwards, err)
+	}
+
+	if err := os.WriteFile(path+".json", []byte(`{"mysql":"port"}`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadForwardCache(path); err == nil {
+		t.Fatal("expected: an error for an invalid port")
+	}
+
+	if !IsForwardCache(path + ".json") {
+		t.Fatalf("expected: %v to be a forward cache", path)
+	}
+	for _, f := range []string{path, filepath.Join(filepath.Dir(path), "db1.json")} {
+		if IsForwardCache(f) {
+			t.Fatalf("expected: %v to not be a forward cache", f)
+		}
+	}
+}
+
+func TestGetControlPath(t *testing.T) {
+	args := map[string]interface{}{"HostName": "10.0.0.1", "User": "test", "Port": "2222"}
+	conn := Connection{}
+	conn.BuildConnection(args, "test", "test")
+
+	if path := GetControlPath(args, "test"); path != conn.ControlPath {
+		t.Fatalf("expected: %v got: %v", conn.ControlPath, path)
+	}
+}
+
+func TestResolveForward(t *testing.T) {
+	args := map[string]interface{}{"Forwards": "mysql:3306"}
+
+	if svc, err := ResolveForward(args, "mysql"); err != nil || svc.Name != "mysql" || svc.Port != 3306 {
+		t.Fatalf("expected: stored mysql forward got: %v (%v)", svc, err)
+	}
+	if svc, err := ResolveForward(args, "9090"); err != nil || svc.Name != "CUSTOM9090" || svc.Port != 9090 {
+		t.Fatalf("expected: adhoc forward got: %v (%v)", svc, err)
+	}
+	if _, err := ResolveForward(args, "grafana"); err == nil {
+		t.Fatal("expected: an error for an unknown forward")
+	}
+
+	svc, _ := ResolveForward(args, "9090")
+	if _, err := CancelForward(filepath.Join(t.TempDir(), "cp_test"), svc); err == nil {
+		t.Fatal("expected: an error when the forward does not exist")
+	}
+}
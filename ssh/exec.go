@@ -0,0 +1,34 @@
+package ssh
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// ExecArgs returns the arguments to run a command on the connection
+// without a TTY or any prompts
+// command : the command to run
+func (c *Connection) ExecArgs(command []string) []string {
+	args := append(c.TransferOptions(), "-T", "-o", "BatchMode=yes", "--", c.HostName)
+	return append(args, command...)
+}
+
+// Exec runs ssh non-interactively, returning the exit code
+// args : the arguments for ssh
+// stdout : destination for the output
+// stderr : destination for the errors
+func Exec(args []string, stdout io.Writer, stderr io.Writer) (int, error) {
+	cmd := exec.Command("ssh", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return -1, err
+	}
+	return 0, nil
+}
@@ -8,12 +8,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"maps"
 	"net"
 	"os"
 	"os/exec"
-	"reflect"
 	"regexp"
 	"slices"
 	"strconv"
@@ -24,6 +22,11 @@ import (
 	"github.com/cezmunsta/ssh_ms/log"
 )
 
+const (
+	defaultServerAliveInterval = uint16(30)
+	defaultServerAliveCountMax = uint16(3)
+)
+
 var (
 	errNoFreePort       = fmt.Errorf("no free port")
 	localForwardPortMin = uint16(18000)
@@ -31,6 +34,14 @@ var (
 
 	cfg = config.GetConfig()
 
+	// connectionKeywords have dedicated handling, rather than being passed
+	// to ssh using ExtraOptions
+	connectionKeywords = []string{
+		"Compression", "ControlMaster", "ControlPath", "ControlPersist", "DynamicForward",
+		"ForwardAgent", "HostName", "IdentitiesOnly", "IdentityFile", "LocalForward", "Port",
+		"ProxyJump", "RemoteForward", "SendEnv", "ServerAliveCountMax", "ServerAliveInterval", "User",
+	}
+
 	// Placeholders are used for templated connections
 	Placeholders = map[string]string{
 		"@@USER_INITIAL_LASTNAME":          "{{.FirstNameInitial}}{{.LastName}}",
@@ -48,11 +59,6 @@ var (
 	}
 )
 
-const (
-	nginxPort = uint16(443)
-	pmmPort   = uint16(8443)
-)
-
 // UserEnv contains settings from the ENV
 type UserEnv struct {
 	User     string
@@ -71,18 +77,100 @@ type Connection struct {
 	Port                uint16
 	User                string
 	LocalForward        []LocalForward
+	RemoteForward       []RemoteForward
+	DynamicForward      uint16
+	SocksDomains        []string
 	IdentityFile        string
 	IdentitiesOnly      bool
 	ProxyJump           string
+	ProxyCommand        string
 	SendEnv             string
 	ServerAliveInterval uint16
 	ServerAliveCountMax uint16
 	Cache               CachedConnection
 	ControlPath         string
+	ControlMaster       string
+	ControlPersist      string
+	Compression         string
 	ForwardAgent        string
-	// Compression bool
-	// ControlMaster bool
-	// ControlPersist uint16
+	ExtraOptions        []Option
+	// Lookup is used to resolve ProxyJump hosts that are stored connections
+	Lookup ConnectionLookup
+}
+
+// Option is an ssh_config keyword along with its value
+type Option struct {
+	Keyword string
+	Value   string
+	// args overrides the arguments used for ssh, which default to -o Keyword=Value
+	args []string
+}
+
+// Args returns the arguments used to pass the option to ssh
+func (o Option) Args() []string {
+	if o.args != nil {
+		return o.args
+	}
+	return []string{"-o", fmt.Sprintf("%s=%s", o.Keyword, o.Value)}
+}
+
+// Options returns the ssh_config options for the connection, in the
+// order that they are displayed
+func (c *Connection) Options() []Option {
+	var options []Option
+
+	add := func(keyword string, value string, args ...string) {
+		if val, ok := SkipOnEmpty[keyword]; ok && val == value {
+			return
+		}
+		options = append(options, Option{Keyword: keyword, Value: value, args: args})
+	}
+
+	// HostName is passed to ssh as the destination
+	add("HostName", c.HostName, []string{}...)
+	add("Port", fmt.Sprintf("%d", c.Port), "-p", fmt.Sprintf("%d", c.Port))
+	add("User", c.User)
+	for _, rf := range c.RemoteForward {
+		bind := ""
+		if rf.BindHost != "" {
+			bind = rf.BindHost + ":"
+		}
+		add("RemoteForward", fmt.Sprintf("%s%d %s:%d", bind, rf.RemotePort, rf.LocalHost, rf.LocalPort), "-R", rf.String())
+	}
+	if c.DynamicForward > 0 {
+		df := fmt.Sprintf("127.0.0.1:%d", c.DynamicForward)
+		add("DynamicForward", df, "-D", df)
+	}
+	for _, f := range c.identityFiles() {
+		add("IdentityFile", f)
+	}
+	add("IdentitiesOnly", "yes")
+	if c.ProxyCommand != "" {
+		add("ProxyCommand", c.ProxyCommand)
+	} else {
+		add("ProxyJump", c.ProxyJump)
+	}
+	add("SendEnv", c.SendEnv)
+	if c.ServerAliveInterval > 0 {
+		add("ServerAliveInterval", fmt.Sprintf("%d", c.ServerAliveInterval))
+	}
+	if c.ServerAliveCountMax > 0 {
+		add("ServerAliveCountMax", fmt.Sprintf("%d", c.ServerAliveCountMax))
+	}
+	add("ControlPath", c.ControlPath)
+	// Multiplexing and compression are left to ~/.ssh/config unless stored
+	if c.ControlMaster != "" {
+		add("ControlMaster", c.ControlMaster)
+	}
+	if c.ControlPersist != "" {
+		add("ControlPersist", c.ControlPersist)
+	}
+	if c.Compression != "" {
+		add("Compression", c.Compression)
+	}
+	add("ForwardAgent", c.ForwardAgent)
+
+	return append(options, c.ExtraOptions...)
 }
 
 // CachedConnection contains a full config
@@ -95,8 +183,38 @@ type LocalForward struct {
 	LocalPort  uint16
 	RemotePort uint16
 	BindHost   string
+	Name       string
+	Scheme     string
+	Path       string
 }
 
+// newLocalForward creates a LocalForward for a service
+// lp : the local port
+// svc : the service to forward
+func newLocalForward(lp uint16, svc config.Service) LocalForward {
+	return LocalForward{
+		LocalPort:  lp,
+		RemotePort: svc.Port,
+		BindHost:   svc.BindHost,
+		Name:       getForwardName(svc.Name),
+		Scheme:     svc.Scheme,
+		Path:       svc.Path,
+	}
+}
+
+// URL produces the local address for the forwarded service
+func (lf LocalForward) URL() string {
+	return fmt.Sprintf("%s://127.0.0.1:%d%s", lf.Scheme, lf.LocalPort, lf.Path)
+}
+
+// String produces the forwarding specification used by ssh -L
+func (lf LocalForward) String() string {
+	return fmt.Sprintf("%d:%s:%d", lf.LocalPort, lf.BindHost, lf.RemotePort)
+}
+
+// RemoteForward stores the reverse port-forwarding details
+type RemoteForward = config.RemoteForward
+
 // acquirePort for LocalForward
 // min : lowest port to choose
 // max : highest port to choose
@@ -358,7 +476,19 @@ func setIdentity(sshArgs *Connection, args map[string]interface{}) {
 	if val, ok := args["IdentityFile"]; ok {
 		option = val.(string)
 	}
-	sshArgs.IdentityFile = fmt.Sprintf("IdentityFile=%s", option)
+	sshArgs.IdentityFile = option
+}
+
+// identityFiles returns each of the keys to offer, as several can be
+// stored using a comma-separated list
+func (c *Connection) identityFiles() []string {
+	var files []string
+	for _, f := range strings.Split(c.IdentityFile, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
 }
 
 // setProxy specifies the ProxyJump value for SSH
@@ -399,122 +529,181 @@ func setControlPath(sshArgs *Connection, args map[string]interface{}) {
 	sshArgs.ControlPath = fmt.Sprintf("%s/%s", cfg.StoragePath, option)
 }
 
-// setPortForwarding for the connection
-// sshArgs : Connection properties for SSH
-func setPortForwarding(sshArgs *Connection) {
-	var lf LocalForward
-	var data map[string]interface{}
-	var targets []string
+// parseForwards converts a list of named forwards into services
+// spec : comma-separated list of name:definition pairs, e.g. mysql:3306,grafana:http://:3000/login
+func parseForwards(spec string) map[string]config.Service {
+	forwards, errs := config.ParseServices(spec, ",")
+	for _, err := range errs {
+		log.Warning(err)
+	}
+	return forwards
+}
 
+// getForwardTargets returns the services to forward, keyed by name,
+// using the --local-forward flag, the stored Forwards or the ServiceMap
+// args : options provided for inspection
+func getForwardTargets(args map[string]interface{}) map[string]config.Service {
 	cfg := config.GetConfig()
-	hasCustomForwardFlag := len(cfg.CustomLocalForward) > 0
 
-	if hasCustomForwardFlag {
+	if len(cfg.CustomLocalForward) > 0 {
+		targets := map[string]config.Service{}
 		for _, k := range strings.Split(cfg.CustomLocalForward, ",") {
-			targets = append(targets, fmt.Sprintf("CUSTOM%s", k))
+			name := "CUSTOM" + strings.TrimSpace(k)
+			if svc, err := config.ParseService(name, k); err == nil {
+				targets[name] = svc
+			} else {
+				log.Warning(err)
+			}
 		}
-	} else {
-		// Use config["ServiceMap"] when custom flags are not used
-		targets = slices.Sorted(maps.Keys(cfg.ServiceMap))
+		return targets
 	}
 
-	_, err := os.Stat(sshArgs.ControlPath)
-	if err == nil {
+	if val, ok := args["Forwards"]; ok {
+		return parseForwards(fmt.Sprintf("%v", val))
+	}
+	return cfg.ServiceMap
+}
+
+// ResolveForward returns the service to forward for a connection, using
+// the name of a stored forward or service, otherwise a service definition
+// args : options provided for inspection
+// spec : the name of the forward, a port or a service definition
+func ResolveForward(args map[string]interface{}, spec string) (config.Service, error) {
+	spec = strings.TrimSpace(spec)
+	if svc, ok := getForwardTargets(args)[spec]; ok {
+		return svc, nil
+	}
+	return config.ParseService("CUSTOM"+spec, spec)
+}
+
+// getForwardName returns the display name for a forward, with adhoc
+// forwards from --local-forward left unnamed
+func getForwardName(key string) string {
+	if strings.HasPrefix(key, "CUSTOM") {
+		return ""
+	}
+	return key
+}
+
+// setPortForwarding for the connection
+// sshArgs : Connection properties for SSH
+// args : options provided for inspection
+func setPortForwarding(sshArgs *Connection, args map[string]interface{}) {
+	targets := getForwardTargets(args)
+	names := slices.Sorted(maps.Keys(targets))
+	sshArgs.LocalForward = []LocalForward{}
+
+	if _, err := os.Stat(sshArgs.ControlPath); err == nil {
 		log.Debug("ControlPath exists")
-		read, err := ioutil.ReadFile(sshArgs.ControlPath + ".json")
-		if err == nil {
+		if cached, err := ReadForwardCache(sshArgs.ControlPath); err == nil {
 			log.Debug("Reading cached port-forwards")
-			if err := json.Unmarshal(read, &data); err == nil {
-				for _, k := range targets {
-					log.Debug("Setting port for: ", k)
-					if val, ok := data[k]; ok {
-						p := uint16(0)
-						if cp, err := strconv.ParseUint(val.(string), 10, 16); err != nil {
-							log.Warningf("Failed to modify custom port (%v): %v", k, err)
-							continue
-						} else {
-							p = uint16(cp)
-						}
-
-						// TODO: adjust to use config["ServiceMap"] lookups
-						if _, err := acquirePort(p, p); err != nil {
-							log.Debugf("Found port '%v' in use, reusing", val)
-							rp := uint16(0)
-							switch k {
-							case "NGINX":
-								rp = nginxPort
-							case "PMM":
-								rp = pmmPort
-							default:
-								if cp, err := strconv.ParseUint(strings.Replace(k, "CUSTOM", "", 1), 10, 16); err != nil {
-									log.Warningf("Failed to modify custom port (%v): %v", k, err)
-									continue
-								} else {
-									rp = uint16(cp)
-								}
-							}
-							sshArgs.LocalForward = append(sshArgs.LocalForward, LocalForward{p, rp, "127.0.0.1"})
-						}
+			for _, k := range names {
+				log.Debug("Setting port for: ", k)
+				if p, ok := cached[k]; ok {
+					if _, err := acquirePort(p, p); err != nil {
+						log.Debugf("Found port '%v' in use, reusing", p)
+						sshArgs.LocalForward = append(sshArgs.LocalForward, newLocalForward(p, targets[k]))
 					}
 				}
-				if len(sshArgs.LocalForward) == len(targets) {
-					return
-				}
-				sshArgs.LocalForward = []LocalForward{}
 			}
+			if len(sshArgs.LocalForward) == len(targets) {
+				return
+			}
+			sshArgs.LocalForward = []LocalForward{}
+		} else {
+			log.Debugf("Unable to read cached port-forwards: %v", err)
 		}
-
 	}
 
 	p := localForwardPortMin
-	data = map[string]interface{}{}
-	utargets := []uint16{}
-
-	if hasCustomForwardFlag {
-		for _, port := range targets {
-			custom := strings.Replace(port, "CUSTOM", "", 1)
-			if iport, err := strconv.ParseUint(custom, 10, 16); err == nil {
-				utargets = append(utargets, uint16(iport))
-			}
-		}
-	} else {
-		for _, port := range cfg.ServiceMap {
-			if iport, err := strconv.ParseUint(port, 10, 16); err == nil {
-				utargets = append(utargets, uint16(iport))
-			}
-		}
-	}
+	data := map[string]uint16{}
 
-	for _, rp := range utargets {
+	for _, k := range names {
 		lp, err := acquirePort(p, localForwardPortMax)
 		if err != nil {
 			panic(err)
 		}
 		p = lp + 1
-		lf = LocalForward{lp, rp, "127.0.0.1"}
+		lf := newLocalForward(lp, targets[k])
 		if sshArgs.exists(lf) { // Ignore duplicate rules, should they appear
 			continue
 		}
 		sshArgs.LocalForward = append(sshArgs.LocalForward, lf)
-		key := ""
-		switch rp {
-		case uint16(nginxPort):
-			key = "NGINX"
-		case uint16(pmmPort):
-			key = "PMM"
-		default:
-			key = fmt.Sprintf("CUSTOM%d", rp)
+		data[k] = lp
+	}
+
+	if err := writeForwardCache(sshArgs.ControlPath, data); err != nil {
+		log.Errorf("Failed to save cache for '%v': %v", sshArgs.ControlPath, err)
+	}
+}
+
+// setRemoteForward for the connection
+// args : options provided for inspection
+func setRemoteForward(sshArgs *Connection, args map[string]interface{}) {
+	sshArgs.RemoteForward = []RemoteForward{}
+	val, ok := args["RemoteForward"]
+	if !ok {
+		return
+	}
+
+	for _, spec := range strings.Split(fmt.Sprintf("%v", val), ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		rf, err := config.ParseRemoteForward(spec)
+		if err != nil {
+			log.Warning(err)
+			continue
 		}
-		data[key] = fmt.Sprintf("%d", lp)
+		sshArgs.RemoteForward = append(sshArgs.RemoteForward, rf)
 	}
+}
 
-	buff, err := json.Marshal(data)
-	if err != nil {
-		log.Errorf("Failed to generate JSON to cache '%v': %v", sshArgs.ControlPath, err)
+// setDynamicForward for the connection, which is enabled by either the
+// stored DynamicForward port or the --socks flag
+// args : options provided for inspection
+// allocate : allocate a port when set to auto, otherwise it is left disabled
+func setDynamicForward(sshArgs *Connection, args map[string]interface{}, allocate bool) {
+	option := uint16(0)
+	socksPort := cfg.SocksPort
+
+	if val, ok := args["DynamicForward"]; ok && socksPort == "" {
+		socksPort = fmt.Sprintf("%v", val)
 	}
 
-	if err := ioutil.WriteFile(sshArgs.ControlPath+".json", []byte(string(buff)), 0o640); err != nil {
-		log.Errorf("Failed to save cache for '%v': %v", sshArgs.ControlPath, err)
+	switch socksPort {
+	case "":
+	case "auto":
+		if !allocate {
+			break
+		}
+		p := localForwardPortMin
+		for _, lf := range sshArgs.LocalForward {
+			if lf.LocalPort >= p {
+				p = lf.LocalPort + 1
+			}
+		}
+		if lp, err := acquirePort(p, localForwardPortMax); err != nil {
+			log.Warningf("Unable to allocate a port for DynamicForward: %v", err)
+		} else {
+			option = lp
+		}
+	default:
+		if dp, err := strconv.ParseUint(socksPort, 10, 16); err != nil {
+			log.Warningf("Invalid port for DynamicForward (%v): %v", socksPort, err)
+		} else {
+			option = uint16(dp)
+		}
+	}
+	sshArgs.DynamicForward = option
+
+	sshArgs.SocksDomains = []string{}
+	if val, ok := args["SocksDomains"]; ok {
+		for _, d := range strings.Split(fmt.Sprintf("%v", val), ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				sshArgs.SocksDomains = append(sshArgs.SocksDomains, d)
+			}
+		}
 	}
 }
 
@@ -539,71 +728,176 @@ func setSendEnv(sshArgs *Connection, args map[string]interface{}) {
 	sshArgs.SendEnv = option
 }
 
+// validOption returns the value for an option when it is valid for ssh
+// args : options provided for inspection
+// keyword : the option to check
+func validOption(args map[string]interface{}, keyword string) (string, bool) {
+	val, ok := args[keyword]
+	if !ok {
+		return "", false
+	}
+
+	v := fmt.Sprintf("%v", val)
+	if kw, ok := config.LookupKeyword(keyword); ok {
+		if err := kw.Validate(v); err != nil {
+			log.Warning(err)
+			return "", false
+		}
+	}
+	return strings.ToLower(v), true
+}
+
+// setCompression for the connection, when it is stored
+// args : options provided for inspection
+func setCompression(sshArgs *Connection, args map[string]interface{}) {
+	sshArgs.Compression = ""
+	if val, ok := validOption(args, "Compression"); ok {
+		sshArgs.Compression = val
+	}
+}
+
+// setControlMaster for the connection, along with ControlPersist, when they
+// are stored so that any multiplexing settings in ~/.ssh/config still apply
+// args : options provided for inspection
+func setControlMaster(sshArgs *Connection, args map[string]interface{}) {
+	sshArgs.ControlMaster = ""
+	if val, ok := validOption(args, "ControlMaster"); ok {
+		sshArgs.ControlMaster = val
+	}
+
+	sshArgs.ControlPersist = ""
+	if val, ok := validOption(args, "ControlPersist"); ok {
+		sshArgs.ControlPersist = val
+	}
+}
+
+// setServerAlive for the connection, using ServerAliveInterval and
+// ServerAliveCountMax to detect unresponsive links
+// args : options provided for inspection
+func setServerAlive(sshArgs *Connection, args map[string]interface{}) {
+	options := map[string]*uint16{
+		"ServerAliveInterval": &sshArgs.ServerAliveInterval,
+		"ServerAliveCountMax": &sshArgs.ServerAliveCountMax,
+	}
+	sshArgs.ServerAliveInterval = defaultServerAliveInterval
+	sshArgs.ServerAliveCountMax = defaultServerAliveCountMax
+
+	for k, option := range options {
+		val, ok := args[k]
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseUint(fmt.Sprintf("%v", val), 10, 16); err != nil {
+			log.Warningf("Invalid value for %s (%v), using %d", k, val, *option)
+		} else {
+			*option = uint16(v)
+		}
+	}
+}
+
+// setExtraOptions for the connection, using the options in the catalogue
+// that do not have dedicated handling
+// args : options provided for inspection
+func setExtraOptions(sshArgs *Connection, args map[string]interface{}) {
+	sshArgs.ExtraOptions = []Option{}
+
+	for _, k := range slices.Sorted(maps.Keys(args)) {
+		kw, ok := config.LookupKeyword(k)
+		if !ok {
+			log.Debugf("Ignoring unknown option: %v", k)
+			continue
+		}
+		if kw.Internal || slices.Contains(connectionKeywords, kw.Name) {
+			continue
+		}
+		if kw.Name == "ProxyCommand" && sshArgs.ProxyCommand != "" {
+			log.Warning("Ignoring ProxyCommand as it is replaced by the ProxyJump hosts")
+			continue
+		}
+
+		v := fmt.Sprintf("%v", args[k])
+		if err := kw.Validate(v); err != nil {
+			log.Warning(err)
+			continue
+		}
+		sshArgs.ExtraOptions = append(sshArgs.ExtraOptions, Option{Keyword: kw.Name, Value: v})
+	}
+}
+
 // BuildConnection creates the SSH command for execution
 // args : options provided for inspection
-func (c *Connection) BuildConnection(args map[string]interface{}, key string, templateUser string) []string {
+func (c *Connection) BuildConnection(args map[string]interface{}, key string, templateUser string) ([]string, error) {
 	var sshArgsList []string
 
+	if err := c.configure(args, key, templateUser, true); err != nil {
+		return nil, err
+	}
+
+	for _, o := range c.Options() {
+		sshArgsList = append(sshArgsList, o.Args()...)
+	}
+
+	// LocalForward ports are allocated for each session, so are only passed as args
+	for _, lf := range c.LocalForward {
+		sshArgsList = append(sshArgsList, "-L", lf.String())
+	}
+	return append(sshArgsList, c.HostName), nil
+}
+
+// RenderConnection produces the config for display or export, without
+// allocating ports for forwards or saving them alongside the ControlPath
+// args : options provided for inspection
+func (c *Connection) RenderConnection(args map[string]interface{}, key string, templateUser string) error {
+	return c.configure(args, key, templateUser, false)
+}
+
+// configure sets the properties of the connection and renders the config
+// args : options provided for inspection
+// allocate : allocate local ports for the forwards
+func (c *Connection) configure(args map[string]interface{}, key string, templateUser string, allocate bool) error {
 	setUser(c, args, templateUser)
 	setPort(c, args)
 	setIdentity(c, args)
 	setProxy(c, args)
+	if err := setProxyCommand(c, key, templateUser); err != nil {
+		return err
+	}
 	setHostname(c, args)
 	setControlPath(c, args)
-	setPortForwarding(c)
+	setControlMaster(c, args)
+	setCompression(c, args)
+	setServerAlive(c, args)
+	c.LocalForward = []LocalForward{}
+	if allocate {
+		setPortForwarding(c, args)
+	}
+	setRemoteForward(c, args)
+	setDynamicForward(c, args, allocate)
 	setForwardAgent(c, args)
 	setSendEnv(c, args)
-
-	d := reflect.ValueOf(c).Elem()
-	t := d.Type()
-	ind := "  "
+	setExtraOptions(c, args)
 
 	c.Cache.Config = fmt.Sprintln("Host", key)
-
-	for i := 0; i < d.NumField(); i++ {
-		f, n := d.Field(i), t.Field(i).Name
-		switch n {
-		case "HostName":
-			c.Cache.Config += fmt.Sprintln(ind, t.Field(i).Name, f.Interface())
-		case "IdentitiesOnly", "ServerAliveCountMax", "ServerAliveInterval", "Cache":
-			continue
-		case "IdentityFile":
-			c.Cache.Config += fmt.Sprintln(ind, strings.Replace(f.Interface().(string), "=", " ", 1))
-			c.Cache.Config += fmt.Sprintln(ind, "IdentitiesOnly yes")
-			sshArgsList = append(sshArgsList, []string{
-				"-o", "IdentitiesOnly=yes",
-				"-o", f.Interface().(string),
-			}...)
-		case "LocalForward":
-			for _, lf := range c.LocalForward {
-				sshArgsList = append(sshArgsList, []string{
-					"-L", fmt.Sprintf("%d:%s:%d", lf.LocalPort, lf.BindHost, lf.RemotePort),
-				}...)
-			}
-		case "Port":
-			c.Cache.Config += fmt.Sprintln(ind, t.Field(i).Name, c.Port)
-			sshArgsList = append(sshArgsList, []string{
-				"-p", fmt.Sprintf("%d", c.Port),
-			}...)
-		default:
-			if val, ok := SkipOnEmpty[n]; ok && val == fmt.Sprintf("%s", f.Interface()) {
-				continue
-			}
-			c.Cache.Config += fmt.Sprintln(ind, t.Field(i).Name, f.Interface())
-			sshArgsList = append(sshArgsList, []string{
-				"-o", fmt.Sprintf("%s=%s", t.Field(i).Name, f.Interface()),
-			}...)
-		}
+	for _, o := range c.Options() {
+		c.Cache.Config += fmt.Sprintln("  ", o.Keyword, o.Value)
 	}
-	return append(sshArgsList, c.HostName)
+	return nil
 }
 
 // Connect executes the SSH command
 // args : options provided for inspection
 // e : user environment settings
 func Connect(args []string, e UserEnv) {
+	Run("ssh", args, e)
+}
+
+// Run executes a command that uses SSH, such as ssh, scp or rsync
+// command : the command to execute
+// args : options provided for inspection
+// e : user environment settings
+func Run(command string, args []string, e UserEnv) {
 	if e.Simulate {
-		log.Println("cmd: ssh", strings.Join(args, " "))
+		log.Println("cmd:", command, strings.Join(args, " "))
 	} else {
 		if len(cfg.UndesiredInterfaces) > 0 {
 			log.Debug("Interface check enabled, checking before connecting")
@@ -615,7 +909,7 @@ func Connect(args []string, e UserEnv) {
 			}
 		}
 
-		cmd := exec.Command("ssh", args...)
+		cmd := exec.Command(command, args...)
 		cmd.Stderr = os.Stderr
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 
@@ -161,7 +162,7 @@ func TestConnection(t *testing.T) {
 	if err := ioutil.WriteFile(conn.ControlPath, []byte(""), 0o600); err != nil {
 		t.Fatal("failed to write dummy ControlPath:", conn.ControlPath, err)
 	}
-	setPortForwarding(&conn)
+	setPortForwarding(&conn, dummyArgs)
 	for _, lf := range conn.LocalForward {
 		switch lf.RemotePort {
 		case 9998, 9999:
@@ -192,3 +193,191 @@ func TestConnection(t *testing.T) {
 		t.Fatalf("expected: SendEnv USER to be present, got: %v", conn.Cache.Config)
 	}
 }
+
+func TestRemoteForward(t *testing.T) {
+	rfConn := Connection{}
+	rfArgs := map[string]interface{}{
+		"HostName":      "localhost",
+		"RemoteForward": "9000:localhost:8080,invalid,127.0.0.1:8443 localhost:443",
+	}
+	rfList, _ := rfConn.BuildConnection(rfArgs, "dummy", "dummy")
+	sshArgs := strings.Join(rfList, " ")
+
+	if len(rfConn.RemoteForward) != 2 {
+		t.Fatalf("expected: 2 RemoteForward rules, got: %v", rfConn.RemoteForward)
+	}
+	if !strings.Contains(sshArgs, "-R 9000:localhost:8080 -R 127.0.0.1:8443:localhost:443") {
+		t.Fatalf("expected: -R args, got: %v", sshArgs)
+	}
+	if !strings.Contains(rfConn.Cache.Config, "RemoteForward 127.0.0.1:8443 localhost:443") {
+		t.Fatalf("expected: RemoteForward in config, got: %v", rfConn.Cache.Config)
+	}
+}
+
+func TestDynamicForward(t *testing.T) {
+	cfg := config.GetConfig()
+	defer func() { cfg.SocksPort = "" }()
+
+	dfConn := Connection{}
+	args := map[string]interface{}{"HostName": "localhost"}
+	dfConn.BuildConnection(args, "dummy", "dummy")
+	if dfConn.DynamicForward != 0 || strings.Contains(dfConn.Cache.Config, "DynamicForward") {
+		t.Fatalf("expected: DynamicForward to be disabled, got: %v", dfConn.DynamicForward)
+	}
+
+	args["DynamicForward"] = "1080"
+	args["SocksDomains"] = "*.corp, acme.internal"
+	dfList, _ := dfConn.BuildConnection(args, "dummy", "dummy")
+	sshArgs := strings.Join(dfList, " ")
+	if !strings.Contains(sshArgs, "-D 127.0.0.1:1080") || len(dfConn.SocksDomains) != 2 {
+		t.Fatalf("expected: -D 127.0.0.1:1080 with 2 domains, got: %v, %v", sshArgs, dfConn.SocksDomains)
+	}
+	if strings.Contains(sshArgs, "SocksDomains") {
+		t.Fatalf("expected: SocksDomains to be absent from args, got: %v", sshArgs)
+	}
+
+	cfg.SocksPort = "auto"
+	dfConn.BuildConnection(args, "dummy", "dummy")
+	for _, lf := range dfConn.LocalForward {
+		if lf.LocalPort >= dfConn.DynamicForward {
+			t.Fatalf("expected: DynamicForward above LocalForward ports, got: %v, %v", dfConn.DynamicForward, dfConn.LocalForward)
+		}
+	}
+	if dfConn.DynamicForward < localForwardPortMin {
+		t.Fatalf("expected: an allocated port, got: %v", dfConn.DynamicForward)
+	}
+}
+
+func TestForwards(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.CustomLocalForward = ""
+
+	if forwards := parseForwards("mysql:3306, grafana:3000,invalid,bad:port,:22"); len(forwards) != 2 || forwards["mysql"].Port != 3306 || forwards["grafana"].Port != 3000 {
+		t.Fatalf("expected: mysql and grafana, got: %v", forwards)
+	}
+
+	fwdConn := Connection{}
+	args := map[string]interface{}{
+		"HostName": "localhost",
+		"Port":     "29023",
+		"Forwards": "mysql:3306,grafana:3000",
+	}
+	fwdConn.BuildConnection(args, "dummy", "dummy")
+
+	if len(fwdConn.LocalForward) != 2 {
+		t.Fatalf("expected: 2 LocalForward rules, got: %v", fwdConn.LocalForward)
+	}
+	for _, lf := range fwdConn.LocalForward {
+		switch {
+		case lf.Name == "grafana" && lf.RemotePort == 3000:
+		case lf.Name == "mysql" && lf.RemotePort == 3306:
+		default:
+			t.Fatalf("unexpected forward: %v", lf)
+		}
+	}
+
+	// The flag takes priority over the stored forwards
+	cfg.CustomLocalForward = "9090"
+	defer func() { cfg.CustomLocalForward = "" }()
+	fwdConn.BuildConnection(args, "dummy", "dummy")
+	if len(fwdConn.LocalForward) != 1 || fwdConn.LocalForward[0].RemotePort != 9090 || fwdConn.LocalForward[0].Name != "" {
+		t.Fatalf("expected: a single unnamed forward to 9090, got: %v", fwdConn.LocalForward)
+	}
+}
+
+func TestConnectionOptions(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.CustomLocalForward = ""
+
+	conn := Connection{}
+	args, _ := conn.BuildConnection(map[string]interface{}{"HostName": "10.0.0.1"}, "dummy", "dummy")
+	for _, opt := range []string{"ServerAliveInterval=30", "ServerAliveCountMax=3"} {
+		if !slices.Contains(args, opt) {
+			t.Fatalf("expected: %v in args, got: %v", opt, args)
+		}
+	}
+	for _, opt := range []string{"ControlMaster", "ControlPersist", "Compression"} {
+		if strings.Contains(strings.Join(args, " "), opt+"=") || strings.Contains(conn.Cache.Config, opt+" ") {
+			t.Fatalf("expected: %v to be left to ~/.ssh/config when not stored, got: %v", opt, args)
+		}
+	}
+
+	conn = Connection{}
+	args, _ = conn.BuildConnection(map[string]interface{}{
+		"HostName":            "10.0.0.1",
+		"Compression":         "yes",
+		"ControlMaster":       "autoask",
+		"ControlPersist":      "1h30m",
+		"ServerAliveInterval": "0",
+		"ServerAliveCountMax": "5",
+	}, "dummy", "dummy")
+	for _, opt := range []string{"Compression=yes", "ControlMaster=autoask", "ControlPersist=1h30m", "ServerAliveCountMax=5"} {
+		if !slices.Contains(args, opt) {
+			t.Fatalf("expected: %v in args, got: %v", opt, args)
+		}
+	}
+	if strings.Contains(conn.Cache.Config, "ServerAliveInterval") || !strings.Contains(conn.Cache.Config, "Compression yes") {
+		t.Fatalf("expected: ServerAliveInterval to be absent and Compression enabled, got: %v", conn.Cache.Config)
+	}
+
+	conn = Connection{}
+	conn.BuildConnection(map[string]interface{}{
+		"HostName":       "10.0.0.1",
+		"ControlMaster":  "always",
+		"ControlPersist": "soon",
+	}, "dummy", "dummy")
+	if conn.ControlMaster != "" || conn.ControlPersist != "" {
+		t.Fatalf("expected: invalid values to be ignored, got: %v, %v", conn.ControlMaster, conn.ControlPersist)
+	}
+}
+
+func TestExtraOptions(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.CustomLocalForward = ""
+
+	conn := Connection{}
+	args, _ := conn.BuildConnection(map[string]interface{}{
+		"HostName":              "10.0.0.1",
+		"ConnectTimeout":        "10",
+		"RemoteCommand":         "tmux new -A -s main",
+		"StrictHostKeyChecking": "maybe",
+		"ConfigComment":         "Not for ssh",
+		"UseRoaming":            "no",
+	}, "dummy", "dummy")
+
+	if len(conn.ExtraOptions) != 2 {
+		t.Fatalf("expected: ConnectTimeout and RemoteCommand, got: %v", conn.ExtraOptions)
+	}
+	for _, opt := range []string{"ConnectTimeout=10", "RemoteCommand=tmux new -A -s main"} {
+		if !slices.Contains(args, opt) {
+			t.Fatalf("expected: %v in args, got: %v", opt, args)
+		}
+	}
+	if !strings.Contains(conn.Cache.Config, "RemoteCommand tmux new -A -s main") {
+		t.Fatalf("expected: RemoteCommand in config, got: %v", conn.Cache.Config)
+	}
+	for _, k := range []string{"StrictHostKeyChecking", "ConfigComment", "UseRoaming"} {
+		if strings.Contains(conn.Cache.Config, k) {
+			t.Fatalf("expected: %v to be absent, got: %v", k, conn.Cache.Config)
+		}
+	}
+	if args[len(args)-1] != "10.0.0.1" || slices.Contains(args, "HostName=10.0.0.1") {
+		t.Fatalf("expected: HostName as the destination, got: %v", args)
+	}
+}
+
+func TestIdentityFiles(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.CustomLocalForward = ""
+
+	conn := Connection{}
+	args, _ := conn.BuildConnection(map[string]interface{}{"HostName": "10.0.0.1", "IdentityFile": "~/.ssh/one, ~/.ssh/two"}, "dummy", "dummy")
+	for _, opt := range []string{"IdentityFile=~/.ssh/one", "IdentityFile=~/.ssh/two"} {
+		if !slices.Contains(args, opt) {
+			t.Fatalf("expected: %v in args, got: %v", opt, args)
+		}
+	}
+	if strings.Count(conn.Cache.Config, "IdentityFile") != 2 {
+		t.Fatalf("expected: an IdentityFile line for each key, got: %v", conn.Cache.Config)
+	}
+}
@@ -0,0 +1,60 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+var errNoDynamicForward = errors.New("DynamicForward is not enabled")
+
+// pacDomains returns the SocksDomains, or the domain of the HostName when
+// none have been specified
+func (c Connection) pacDomains() []string {
+	if len(c.SocksDomains) > 0 || c.HostName == "" || net.ParseIP(c.HostName) != nil {
+		return c.SocksDomains
+	}
+
+	if _, domain, ok := strings.Cut(c.HostName, "."); ok && strings.Contains(domain, ".") {
+		return []string{domain}
+	}
+	return []string{c.HostName}
+}
+
+// pacCondition converts a domain, wildcard pattern or CIDR into a PAC expression
+func pacCondition(domain string) string {
+	domain = strings.ReplaceAll(domain, `"`, "")
+
+	if _, network, err := net.ParseCIDR(domain); err == nil {
+		return fmt.Sprintf(`isInNet(host, "%s", "%s")`, network.IP, net.IP(network.Mask))
+	} else if strings.ContainsAny(domain, "*?") {
+		return fmt.Sprintf(`shExpMatch(host, "%s")`, domain)
+	}
+	return fmt.Sprintf(`host == "%s" || dnsDomainIs(host, ".%s")`, domain, domain)
+}
+
+// PAC produces a proxy auto-config file that routes the SocksDomains for the
+// connection through the DynamicForward port, with all other traffic direct
+func (c Connection) PAC() (string, error) {
+	if c.DynamicForward == 0 {
+		return "", errNoDynamicForward
+	}
+
+	domains := c.pacDomains()
+	if len(domains) == 0 {
+		return "", fmt.Errorf("no SocksDomains available to route via the proxy")
+	}
+
+	b := bytes.Buffer{}
+	proxy := fmt.Sprintf("SOCKS5 127.0.0.1:%d; SOCKS 127.0.0.1:%d", c.DynamicForward, c.DynamicForward)
+
+	fmt.Fprintln(&b, "function FindProxyForURL(url, host) {")
+	for _, d := range domains {
+		fmt.Fprintf(&b, "  if (%s) {\n    return \"%s\";\n  }\n", pacCondition(d), proxy)
+	}
+	fmt.Fprintln(&b, `  return "DIRECT";`)
+	fmt.Fprintln(&b, "}")
+	return b.String(), nil
+}
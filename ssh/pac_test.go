@@ -0,0 +1,33 @@
+package ssh
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPAC(t *testing.T) {
+	if _, err := (Connection{HostName: "db1.acme.internal"}).PAC(); err == nil {
+		t.Fatal("expected: an error when DynamicForward is disabled")
+	}
+
+	if _, err := (Connection{HostName: "10.0.0.1", DynamicForward: 18005}).PAC(); err == nil {
+		t.Fatal("expected: an error when no domains are available")
+	}
+
+	pac, err := Connection{HostName: "db1.acme.internal", DynamicForward: 18005}.PAC()
+	if err != nil || !strings.Contains(pac, `dnsDomainIs(host, ".acme.internal")`) {
+		t.Fatalf("expected: HostName domain to be routed, got: %v, %v", pac, err)
+	}
+	if !strings.Contains(pac, "SOCKS5 127.0.0.1:18005") || !strings.Contains(pac, `return "DIRECT"`) {
+		t.Fatalf("expected: SOCKS5 proxy and DIRECT fallback, got: %v", pac)
+	}
+
+	pac, _ = Connection{
+		HostName:       "10.0.0.1",
+		DynamicForward: 1080,
+		SocksDomains:   []string{"*.corp", "10.20.0.0/16"},
+	}.PAC()
+	if !strings.Contains(pac, `shExpMatch(host, "*.corp")`) || !strings.Contains(pac, `isInNet(host, "10.20.0.0", "255.255.0.0")`) {
+		t.Fatalf("expected: wildcard and CIDR rules, got: %v", pac)
+	}
+}
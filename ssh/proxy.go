@@ -0,0 +1,135 @@
+package ssh
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/cezmunsta/ssh_ms/log"
+)
+
+// shellSafeRegex matches arguments that do not need quoting for the shell
+var shellSafeRegex = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ConnectionLookup returns the stored options for a connection, or nil
+// when the connection does not exist
+type ConnectionLookup func(key string) map[string]interface{}
+
+// shellQuote quotes an argument for use in a ProxyCommand
+func shellQuote(s string) string {
+	if shellSafeRegex.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// proxyArg prepares an argument for use in a ProxyCommand, escaping any
+// tokens so that they are only expanded by the ssh that they are passed to
+func proxyArg(s string) string {
+	return shellQuote(strings.ReplaceAll(s, "%", "%%"))
+}
+
+// setProxyCommand resolves the ProxyJump hosts that are stored connections
+// into a chained ProxyCommand, so that each hop uses its own User, Port
+// and IdentityFile
+// key : the connection, used to detect cycles
+// templateUser : the username for templated connections
+func setProxyCommand(sshArgs *Connection, key string, templateUser string) error {
+	sshArgs.ProxyCommand = ""
+	if sshArgs.Lookup == nil || sshArgs.ProxyJump == "none" {
+		return nil
+	}
+
+	cmd, err := sshArgs.hopCommand(sshArgs.ProxyJump, templateUser, []string{key})
+	if err != nil {
+		return err
+	}
+	sshArgs.ProxyCommand = cmd
+	return nil
+}
+
+// hopCommand produces the ProxyCommand for the last host in a ProxyJump
+// specification, reaching it via the earlier hosts. An empty string is
+// returned when none of the hosts are stored connections, so that the
+// specification can be passed to ssh unchanged
+// spec : comma-separated list of jump hosts
+// templateUser : the username for templated connections
+// chain : the connections visited so far
+func (c *Connection) hopCommand(spec string, templateUser string, chain []string) (string, error) {
+	hops := strings.Split(spec, ",")
+	name := strings.TrimSpace(hops[len(hops)-1])
+	earlier := strings.Join(hops[:len(hops)-1], ",")
+
+	if slices.Contains(chain, name) {
+		return "", fmt.Errorf("ProxyJump cycle detected: %s", strings.Join(append(chain, name), " -> "))
+	}
+
+	var data map[string]interface{}
+	if !strings.ContainsAny(name, "@:") {
+		data = c.Lookup(name)
+	}
+
+	if data == nil {
+		log.Debugf("ProxyJump '%s' is not a stored connection", name)
+		if earlier == "" {
+			return "", nil
+		}
+
+		// Only the earlier hosts can be resolved, so ssh is left to
+		// reach this hop with its own configuration
+		cmd, err := c.hopCommand(earlier, templateUser, chain)
+		if err != nil || cmd == "" {
+			return "", err
+		}
+		dest := name
+		if strings.Contains(dest, ":") && !strings.HasPrefix(dest, "ssh://") {
+			dest = "ssh://" + dest
+		}
+		args := []string{"ssh", "-o", "ProxyCommand=" + cmd}
+		for i, a := range args {
+			args[i] = proxyArg(a)
+		}
+		return strings.Join(append(args, "-W", "%h:%p", proxyArg(dest)), " "), nil
+	}
+
+	hop := Connection{}
+	setUser(&hop, data, templateUser)
+	setPort(&hop, data)
+	setIdentity(&hop, data)
+	setHostname(&hop, data)
+	setProxy(&hop, data)
+	setServerAlive(&hop, data)
+
+	// Earlier hosts in the specification are used to reach this hop
+	if earlier != "" {
+		hop.ProxyJump = earlier
+	}
+
+	args := []string{"ssh", "-p", fmt.Sprintf("%d", hop.Port), "-o", "User=" + hop.User}
+	for _, f := range hop.identityFiles() {
+		args = append(args, "-o", "IdentityFile="+f)
+	}
+	args = append(args,
+		"-o", "IdentitiesOnly=yes",
+		"-o", fmt.Sprintf("ServerAliveInterval=%d", hop.ServerAliveInterval),
+		"-o", fmt.Sprintf("ServerAliveCountMax=%d", hop.ServerAliveCountMax),
+	)
+
+	if hop.ProxyJump != "none" {
+		cmd, err := c.hopCommand(hop.ProxyJump, templateUser, append(chain, name))
+		if err != nil {
+			return "", err
+		}
+		if cmd != "" {
+			args = append(args, "-o", "ProxyCommand="+cmd)
+		} else {
+			args = append(args, "-o", "ProxyJump="+hop.ProxyJump)
+		}
+	}
+
+	for i, a := range args {
+		args[i] = proxyArg(a)
+	}
+	return strings.Join(append(args, "-W", "%h:%p", proxyArg(hop.HostName)), " "), nil
+}
@@ -0,0 +1,113 @@
+package ssh
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cezmunsta/ssh_ms/config"
+)
+
+func TestShellQuote(t *testing.T) {
+	for s, expected := range map[string]string{
+		"10.0.0.1":        "10.0.0.1",
+		"~/.ssh/id_rsa":   "'~/.ssh/id_rsa'",
+		"it's":            `'it'\''s'`,
+		"-W %h:%p":        "'-W %h:%p'",
+		"User=first.last": "User=first.last",
+	} {
+		if q := shellQuote(s); q != expected {
+			t.Fatalf("expected: %v got: %v", expected, q)
+		}
+	}
+}
+
+func TestProxyCommand(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.CustomLocalForward = ""
+
+	stored := map[string]map[string]interface{}{
+		"gw1":    {"HostName": "192.168.0.1", "User": "jump", "IdentityFile": "~/.ssh/gw1"},
+		"gw2":    {"HostName": "10.0.0.1", "Port": "2222", "User": "hop", "ProxyJump": "gw1"},
+		"loop-a": {"HostName": "10.0.0.2", "ProxyJump": "loop-b"},
+		"loop-b": {"HostName": "10.0.0.3", "ProxyJump": "loop-a"},
+	}
+	lookup := func(key string) map[string]interface{} {
+		return stored[key]
+	}
+
+	conn := Connection{Lookup: lookup}
+	conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "gw2"}, "db1", "dummy")
+
+	if !strings.HasPrefix(conn.ProxyCommand, "ssh -p 2222 -o User=hop") || !strings.HasSuffix(conn.ProxyCommand, "-W %h:%p 10.0.0.1") {
+		t.Fatalf("expected: ProxyCommand via gw2, got: %v", conn.ProxyCommand)
+	}
+	if !strings.Contains(conn.ProxyCommand, "-o 'ProxyCommand=ssh -p 22 -o User=jump -o '\\''IdentityFile=~/.ssh/gw1'\\''") {
+		t.Fatalf("expected: nested ProxyCommand via gw1, got: %v", conn.ProxyCommand)
+	}
+	if !strings.Contains(conn.ProxyCommand, "-W %%h:%%p 192.168.0.1'") {
+		t.Fatalf("expected: escaped tokens for gw1, got: %v", conn.ProxyCommand)
+	}
+	if strings.Contains(conn.Cache.Config, "ProxyJump") || !strings.Contains(conn.Cache.Config, "ProxyCommand ssh") {
+		t.Fatalf("expected: ProxyCommand to replace ProxyJump, got: %v", conn.Cache.Config)
+	}
+
+	// A stored ProxyCommand is replaced by the chain for the ProxyJump hosts
+	conn = Connection{Lookup: lookup}
+	args, _ := conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "gw2", "ProxyCommand": "nc %h %p"}, "db1", "dummy")
+	if slices.Contains(args, "ProxyCommand=nc %h %p") || strings.Contains(conn.Cache.Config, "nc %h %p") {
+		t.Fatalf("expected: the stored ProxyCommand to be ignored, got: %v", args)
+	}
+
+	// Earlier hosts in the specification are used to reach the last one
+	conn = Connection{Lookup: lookup}
+	conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "bastion,gw1"}, "db1", "dummy")
+	if !strings.Contains(conn.ProxyCommand, "-o ProxyJump=bastion -W %h:%p 192.168.0.1") {
+		t.Fatalf("expected: ProxyJump via bastion for gw1, got: %v", conn.ProxyCommand)
+	}
+
+	// Hosts that are not stored connections are left for ssh
+	conn = Connection{Lookup: lookup}
+	conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "user@bastion:2222"}, "db1", "dummy")
+	if conn.ProxyCommand != "" || !strings.Contains(conn.Cache.Config, "ProxyJump user@bastion:2222") {
+		t.Fatalf("expected: ProxyJump to be unchanged, got: %v", conn.Cache.Config)
+	}
+
+	// Stored hosts are resolved even when the last one is not stored
+	conn = Connection{Lookup: lookup}
+	conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "gw1,bastion.example.com"}, "db1", "dummy")
+	if !strings.HasPrefix(conn.ProxyCommand, "ssh -o 'ProxyCommand=ssh -p 22 -o User=jump") || !strings.HasSuffix(conn.ProxyCommand, "-W %%h:%%p 192.168.0.1' -W %h:%p bastion.example.com") {
+		t.Fatalf("expected: bastion.example.com via gw1, got: %v", conn.ProxyCommand)
+	}
+	if strings.Contains(conn.Cache.Config, "ProxyJump") {
+		t.Fatalf("expected: ProxyCommand to replace ProxyJump, got: %v", conn.Cache.Config)
+	}
+
+	conn = Connection{Lookup: lookup}
+	conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "gw2,user@bastion:2222"}, "db1", "dummy")
+	if !strings.HasPrefix(conn.ProxyCommand, "ssh -o 'ProxyCommand=ssh -p 2222 -o User=hop") || !strings.HasSuffix(conn.ProxyCommand, " -W %h:%p ssh://user@bastion:2222") {
+		t.Fatalf("expected: user@bastion:2222 via gw2, got: %v", conn.ProxyCommand)
+	}
+
+	conn = Connection{Lookup: lookup}
+	conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "bastion,jump.example.com"}, "db1", "dummy")
+	if conn.ProxyCommand != "" || !strings.Contains(conn.Cache.Config, "ProxyJump bastion,jump.example.com") {
+		t.Fatalf("expected: ProxyJump to be unchanged, got: %v", conn.Cache.Config)
+	}
+
+	// Cycles are detected and stop the connection from being built
+	conn = Connection{Lookup: lookup}
+	if args, err := conn.BuildConnection(stored["loop-a"], "loop-a", "dummy"); err == nil || args != nil {
+		t.Fatalf("expected: an error for a cycle, got: %v, %v", args, err)
+	}
+	conn = Connection{Lookup: lookup}
+	if _, err := conn.BuildConnection(map[string]interface{}{"HostName": "10.1.0.1", "ProxyJump": "loop-a,bastion"}, "db1", "dummy"); err == nil {
+		t.Fatal("expected: an error for a cycle in an earlier hop")
+	}
+	if _, err := conn.hopCommand("loop-b", "dummy", []string{"loop-a"}); err == nil || !strings.Contains(err.Error(), "loop-a -> loop-b -> loop-a") {
+		t.Fatalf("expected: a cycle to be reported, got: %v", err)
+	}
+	if _, err := conn.hopCommand("db1", "dummy", []string{"db1"}); err == nil {
+		t.Fatal("expected: a self-reference to be reported")
+	}
+}
@@ -0,0 +1,46 @@
+package ssh
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// transferExcludedKeywords are not used for file transfers, either because
+// the destination is provided separately or they would interfere with the
+// session used by scp, sftp and rsync
+var transferExcludedKeywords = []string{
+	"DynamicForward", "ForkAfterAuthentication", "HostName", "LocalForward",
+	"RemoteCommand", "RemoteForward", "RequestTTY", "SessionType", "StdinNull",
+}
+
+// TransferOptions returns the options for scp, sftp and rsync, which all
+// accept ssh_config options using -o
+func (c *Connection) TransferOptions() []string {
+	var args []string
+
+	for _, o := range c.Options() {
+		if slices.Contains(transferExcludedKeywords, o.Keyword) {
+			continue
+		}
+		args = append(args, "-o", fmt.Sprintf("%s=%s", o.Keyword, o.Value))
+	}
+	return args
+}
+
+// TransferHost returns the host to use in the path for file transfers
+func (c *Connection) TransferHost() string {
+	if strings.Contains(c.HostName, ":") {
+		return "[" + c.HostName + "]"
+	}
+	return c.HostName
+}
+
+// RsyncShell returns the remote shell command for rsync
+func (c *Connection) RsyncShell() string {
+	args := []string{"ssh"}
+	for _, a := range c.TransferOptions() {
+		args = append(args, shellQuote(a))
+	}
+	return strings.Join(args, " ")
+}
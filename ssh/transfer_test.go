@@ -0,0 +1,55 @@
+package ssh
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cezmunsta/ssh_ms/config"
+)
+
+func TestTransferOptions(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.CustomLocalForward = ""
+
+	conn := Connection{}
+	conn.BuildConnection(map[string]interface{}{
+		"HostName":      "fd00::1",
+		"Port":          "2222",
+		"RemoteCommand": "tmux",
+		"RemoteForward": "9000:localhost:9000",
+	}, "dummy", "dummy")
+
+	opts := conn.TransferOptions()
+	if !slices.Contains(opts, "Port=2222") || !slices.Contains(opts, "ControlPath="+conn.ControlPath) {
+		t.Fatalf("expected: Port and ControlPath, got: %v", opts)
+	}
+	for _, opt := range opts {
+		if strings.HasPrefix(opt, "RemoteCommand") || strings.HasPrefix(opt, "RemoteForward") || strings.HasPrefix(opt, "HostName") {
+			t.Fatalf("expected: %v to be excluded, got: %v", opt, opts)
+		}
+	}
+
+	if host := conn.TransferHost(); host != "[fd00::1]" {
+		t.Fatalf("expected: [fd00::1] got: %v", host)
+	}
+	if shell := conn.RsyncShell(); !strings.HasPrefix(shell, "ssh -o Port=2222") {
+		t.Fatalf("expected: ssh with options, got: %v", shell)
+	}
+}
+
+func TestExecArgs(t *testing.T) {
+	cfg := config.GetConfig()
+	cfg.CustomLocalForward = ""
+
+	conn := Connection{}
+	conn.BuildConnection(map[string]interface{}{"HostName": "10.0.0.1", "RequestTTY": "yes"}, "dummy", "dummy")
+
+	args := conn.ExecArgs([]string{"uptime", "-p"})
+	if !slices.Equal(args[len(args)-5:], []string{"BatchMode=yes", "--", "10.0.0.1", "uptime", "-p"}) {
+		t.Fatalf("expected: the command after the host got: %v", args)
+	}
+	if slices.Contains(args, "RequestTTY=yes") {
+		t.Fatalf("expected: RequestTTY to be excluded got: %v", args)
+	}
+}
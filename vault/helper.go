@@ -2,6 +2,7 @@ package vault
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -25,6 +26,9 @@ type UserEnv struct {
 var (
 	cfg = config.GetConfig()
 
+	// ErrConflict is returned when a check-and-set write is rejected
+	ErrConflict = errors.New("check-and-set conflict, the record was changed by someone else")
+
 	// RenewThreshold is used to compare against the token expiration time
 	RenewThreshold = "168h"
 )
@@ -33,6 +37,11 @@ const (
 	apiTimeout           = time.Second * 60
 	errHasMetadataSuffix = "metadata is a reserved word"
 	errNoMatchFound      = "no match found"
+	errNotSupported      = "not supported, %s is not a KV v2 mount"
+
+	// tagsKey holds the tags for a secret, which are stored in the custom
+	// metadata on KV v2 mounts and as part of the data on KV v1 mounts
+	tagsKey = "Tags"
 )
 
 // Authenticate a user with Vault
@@ -99,7 +108,8 @@ func requiresRenewal(d map[string]interface{}) bool {
 	return true
 }
 
-// DeleteSecret removes a secret from Vault
+// DeleteSecret removes a secret from Vault, on KV v2 mounts only the
+// latest version is deleted so that it can be restored with UndeleteSecret
 func DeleteSecret(c *api.Client, key string) (bool, error) {
 	ctx := context.Background()
 	mountPath, secretName := getSplitPath(key)
@@ -110,7 +120,31 @@ func DeleteSecret(c *api.Client, key string) (bool, error) {
 	if ver, err := getKvVersion(c, mountPath); err == nil {
 		switch ver {
 		case "kv2":
-			// TODO: this should be changed when adding support for revisions
+			if err := c.KVv2(mountPath).Delete(timeout, secretName); err != nil {
+				return false, err
+			}
+		case "kv1":
+			if err := c.KVv1(mountPath).Delete(timeout, secretName); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// DestroySecret permanently removes a secret from Vault, including all
+// versions and metadata on KV v2 mounts
+func DestroySecret(c *api.Client, key string) (bool, error) {
+	ctx := context.Background()
+	mountPath, secretName := getSplitPath(key)
+	timeout, cancel := context.WithTimeout(ctx, apiTimeout)
+
+	defer cancel()
+
+	if ver, err := getKvVersion(c, mountPath); err == nil {
+		switch ver {
+		case "kv2":
 			if err := c.KVv2(mountPath).DeleteMetadata(timeout, secretName); err != nil {
 				return false, err
 			}
@@ -124,7 +158,49 @@ func DeleteSecret(c *api.Client, key string) (bool, error) {
 	return true, nil
 }
 
-// ListSecrets reads the list of secrets/data under a path in Vault
+// UndeleteSecret restores the latest version of a secret when it has been deleted
+// c : Vault client
+// key : the key for the desired secret/data
+func UndeleteSecret(c *api.Client, key string) (int, error) {
+	ctx := context.Background()
+	mountPath, secretName := getSplitPath(key)
+	timeout, cancel := context.WithTimeout(ctx, apiTimeout)
+
+	defer cancel()
+
+	if ver, _ := getKvVersion(c, mountPath); ver != "kv2" {
+		return 0, fmt.Errorf(errNotSupported, mountPath)
+	}
+
+	versions, err := c.KVv2(mountPath).GetVersionsAsList(timeout, secretName)
+	if err != nil {
+		return 0, err
+	} else if len(versions) == 0 {
+		return 0, fmt.Errorf("no versions found for %s", key)
+	}
+
+	latest := versions[len(versions)-1]
+	if latest.Destroyed {
+		return 0, fmt.Errorf("latest version of %s has been destroyed", key)
+	} else if latest.DeletionTime.IsZero() {
+		return 0, fmt.Errorf("latest version of %s is not deleted", key)
+	}
+
+	if err := c.KVv2(mountPath).Undelete(timeout, secretName, []int{latest.Version}); err != nil {
+		return 0, err
+	}
+	return latest.Version, nil
+}
+
+// isDeleted checks whether a version has been deleted or destroyed
+// v : the version metadata
+func isDeleted(v api.KVVersionMetadata) bool {
+	return v.Destroyed || !v.DeletionTime.IsZero()
+}
+
+// ListSecrets reads the list of secrets/data under a path in Vault. On KV v2
+// mounts this includes secrets whose latest version has been deleted, which
+// are reported as missing when they are read
 // c : Vault client
 // path : path to secret/data in Vault
 func ListSecrets(c *api.Client, path string) ([]*api.Secret, []error) {
@@ -165,6 +241,15 @@ func ListSecrets(c *api.Client, path string) ([]*api.Secret, []error) {
 // c : Vault client
 // key : the key for the desired secret/data
 func ReadSecret(c *api.Client, key string) (map[string]interface{}, error) {
+	data, _, err := ReadSecretVersioned(c, key)
+	return data, err
+}
+
+// ReadSecretVersioned requests the secret/data from Vault along with its
+// version, which is always 0 for KV v1 mounts
+// c : Vault client
+// key : the key for the desired secret/data
+func ReadSecretVersioned(c *api.Client, key string) (map[string]interface{}, int, error) {
 	ctx := context.Background()
 	mountPath, secretName := getSplitPath(key)
 	timeout, cancel := context.WithTimeout(ctx, apiTimeout)
@@ -174,17 +259,92 @@ func ReadSecret(c *api.Client, key string) (map[string]interface{}, error) {
 	if ver, err := getKvVersion(c, mountPath); err == nil {
 		switch ver {
 		case "kv2":
-			if secret, _ := c.KVv2(mountPath).Get(timeout, secretName); secret != nil {
-				return secret.Data, nil
+			if secret, _ := c.KVv2(mountPath).Get(timeout, secretName); secret != nil && secret.Data != nil {
+				if secret.VersionMetadata != nil && isDeleted(*secret.VersionMetadata) {
+					break
+				}
+				version := 0
+				if secret.VersionMetadata != nil {
+					version = secret.VersionMetadata.Version
+				}
+				if tags := readTags(secret.CustomMetadata); secret.Data != nil && len(tags) > 0 {
+					secret.Data[tagsKey] = config.FormatTags(tags)
+				}
+				return secret.Data, version, nil
 			}
 		case "kv1":
 			if secret, _ := c.KVv1(mountPath).Get(timeout, secretName); secret != nil {
-				return secret.Data, nil
+				return secret.Data, 0, nil
 			}
 		}
 	}
 
-	return nil, fmt.Errorf(errNoMatchFound)
+	return nil, 0, fmt.Errorf(errNoMatchFound)
+}
+
+// IsVersioned checks whether a secret is stored in a KV v2 mount
+// c : Vault client
+// key : the key for the desired secret/data
+func IsVersioned(c *api.Client, key string) bool {
+	mountPath, _ := getSplitPath(key)
+	ver, _ := getKvVersion(c, mountPath)
+	return ver == "kv2"
+}
+
+// GetCurrentVersion returns the latest version of a secret, along with
+// whether that version has been deleted, or 0 when no versions exist
+// c : Vault client
+// key : the key for the desired secret/data
+func GetCurrentVersion(c *api.Client, key string) (int, bool, error) {
+	versions, err := ListSecretVersions(c, key)
+	if errors.Is(err, api.ErrSecretNotFound) || (err == nil && len(versions) == 0) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	latest := versions[len(versions)-1]
+	return latest.Version, isDeleted(latest), nil
+}
+
+// ListSecretVersions returns the revision history of a secret, oldest first
+// c : Vault client
+// key : the key for the desired secret/data
+func ListSecretVersions(c *api.Client, key string) ([]api.KVVersionMetadata, error) {
+	ctx := context.Background()
+	mountPath, secretName := getSplitPath(key)
+	timeout, cancel := context.WithTimeout(ctx, apiTimeout)
+
+	defer cancel()
+
+	if ver, _ := getKvVersion(c, mountPath); ver != "kv2" {
+		return nil, fmt.Errorf(errNotSupported, mountPath)
+	}
+	return c.KVv2(mountPath).GetVersionsAsList(timeout, secretName)
+}
+
+// ReadSecretVersion requests a specific revision of the secret/data from Vault
+// c : Vault client
+// key : the key for the desired secret/data
+// version : the revision to read
+func ReadSecretVersion(c *api.Client, key string, version int) (map[string]interface{}, error) {
+	ctx := context.Background()
+	mountPath, secretName := getSplitPath(key)
+	timeout, cancel := context.WithTimeout(ctx, apiTimeout)
+
+	defer cancel()
+
+	if ver, _ := getKvVersion(c, mountPath); ver != "kv2" {
+		return nil, fmt.Errorf(errNotSupported, mountPath)
+	}
+
+	secret, err := c.KVv2(mountPath).GetVersion(timeout, secretName, version)
+	if err != nil {
+		return nil, err
+	} else if secret.Data == nil {
+		return nil, fmt.Errorf(errNoMatchFound)
+	}
+	return secret.Data, nil
 }
 
 // WriteSecret adds a secret to Vault
@@ -198,43 +358,24 @@ func WriteSecret(c *api.Client, key string, data map[string]interface{}) (bool,
 
 	defer cancel()
 
-	sanitisedData := make(secretData)
-	keyLookup := map[string]interface{}{
-		"hostname":            "HostName",
-		"port":                "Port",
-		"user":                "User",
-		"localforward":        "LocalForward",
-		"identityfile":        "IdentityFile",
-		"identitiesonly":      "IdentitiesOnly",
-		"proxyjump":           "ProxyJump",
-		"sendenv":             "SendEnv",
-		"serveraliveinterval": "ServerAliveInterval",
-		"serveralivecountmax": "ServerAliveCountMax",
-		"cache":               "Cache",
-		"configcomment":       "ConfigComment",
-		"configmotd":          "ConfigMotd",
-		"expires":             "Expires",
-		"forwardagent":        "ForwardAgent",
-	}
-
-	for k, v := range data {
-		opt := ""
-		lk := strings.ToLower(k)
-		if val, ok := keyLookup[lk]; ok {
-			opt = val.(string)
-		} else {
-			log.Warning("Unknown option received: ", k)
-			continue
-		}
-		sanitisedData[opt] = v
+	sanitisedData, err := sanitiseData(data)
+	if err != nil {
+		return false, err
 	}
 
 	if ver, err := getKvVersion(c, mountPath); err == nil {
 		switch ver {
 		case "kv2":
+			tags, err := splitTags(sanitisedData)
+			if err != nil {
+				return false, err
+			}
 			if _, err := c.KVv2(mountPath).Put(timeout, secretName, sanitisedData); err != nil {
 				return false, err
 			}
+			if err := writeTags(timeout, c.KVv2(mountPath), secretName, tags); err != nil {
+				return false, err
+			}
 		case "kv1":
 			if err := c.KVv1(mountPath).Put(timeout, secretName, sanitisedData); err != nil {
 				return false, err
@@ -247,6 +388,111 @@ func WriteSecret(c *api.Client, key string, data map[string]interface{}) (bool,
 	return true, nil
 }
 
+// WriteSecretCAS adds a secret to a KV v2 mount using check-and-set, so that
+// the write is rejected with ErrConflict if the secret has since changed
+// c : Vault client
+// key : the key for the secret
+// data : config for use when writing data
+// version : the expected current version, 0 to only allow creation
+func WriteSecretCAS(c *api.Client, key string, data map[string]interface{}, version int) (bool, error) {
+	ctx := context.Background()
+	mountPath, secretName := getSplitPath(key)
+	timeout, cancel := context.WithTimeout(ctx, apiTimeout)
+
+	defer cancel()
+
+	if ver, _ := getKvVersion(c, mountPath); ver != "kv2" {
+		return false, fmt.Errorf(errNotSupported, mountPath)
+	}
+
+	sanitisedData, err := sanitiseData(data)
+	if err != nil {
+		return false, err
+	}
+
+	tags, err := splitTags(sanitisedData)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := c.KVv2(mountPath).Put(timeout, secretName, sanitisedData, api.WithCheckAndSet(version)); err != nil {
+		if strings.Contains(err.Error(), "check-and-set") {
+			return false, ErrConflict
+		}
+		return false, err
+	}
+
+	if err := writeTags(timeout, c.KVv2(mountPath), secretName, tags); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// splitTags removes the tags from the data, so that they can be stored
+// in the custom metadata
+func splitTags(data secretData) (map[string]string, error) {
+	spec, ok := data[tagsKey]
+	if !ok {
+		return map[string]string{}, nil
+	}
+	delete(data, tagsKey)
+	return config.ParseTags(fmt.Sprintf("%v", spec))
+}
+
+// readTags converts the custom metadata into tags
+func readTags(metadata map[string]interface{}) map[string]string {
+	tags := map[string]string{}
+
+	for k, v := range metadata {
+		tags[k] = fmt.Sprintf("%v", v)
+	}
+	return tags
+}
+
+// writeTags replaces the custom metadata with the tags, removing any
+// tags that are no longer present
+func writeTags(ctx context.Context, kv *api.KVv2, secretName string, tags map[string]string) error {
+	patch := map[string]interface{}{}
+
+	if metadata, err := kv.GetMetadata(ctx, secretName); err == nil {
+		for k := range readTags(metadata.CustomMetadata) {
+			if _, ok := tags[k]; !ok {
+				patch[k] = nil
+			}
+		}
+	}
+
+	for k, v := range tags {
+		patch[k] = v
+	}
+
+	if len(patch) == 0 {
+		return nil
+	}
+	return kv.PatchMetadata(ctx, secretName, api.KVMetadataPatchInput{CustomMetadata: patch})
+}
+
+// sanitiseData validates the options against the catalogue of keywords
+// and normalises their names. Unknown options are dropped rather than
+// rejected, as they may have been carried over from a stored record
+// written outside of ssh_ms; user input is checked before it gets here.
+func sanitiseData(data map[string]interface{}) (secretData, error) {
+	sanitisedData := make(secretData)
+
+	for k, v := range data {
+		kw, ok := config.LookupKeyword(k)
+		if !ok {
+			log.Warning("Unknown option received: ", k)
+			continue
+		}
+		if err := kw.Validate(fmt.Sprintf("%v", v)); err != nil {
+			return nil, err
+		}
+		sanitisedData[kw.Name] = v
+	}
+	return sanitisedData, nil
+}
+
 func getSplitPath(path string) (string, string) {
 	sp := strings.Split(path, "/")
 
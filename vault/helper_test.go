@@ -1,10 +1,14 @@
 package vault
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/api"
+
 	"github.com/cezmunsta/ssh_ms/helpers"
 )
 
@@ -30,6 +34,31 @@ func TestHelpers(t *testing.T) {
 		if status, err := DeleteSecret(client, key); err != nil || !status {
 			t.Fatalf("DeleteSecret expected: %v, got: %v, %v", data, status, err)
 		}
+
+		if secret, err := ReadSecret(client, key); err == nil {
+			t.Fatalf("ReadSecret expected: an error after delete, got: %v", secret)
+		}
+
+		if strings.HasSuffix(secretPath, "_v2") {
+			if _, _, err := ReadSecretVersioned(client, key); err == nil {
+				t.Fatal("ReadSecretVersioned expected: an error after delete")
+			}
+			if version, err := UndeleteSecret(client, key); err != nil || version == 0 {
+				t.Fatalf("UndeleteSecret expected: a version, got: %v, %v", version, err)
+			}
+			if secret, err := ReadSecret(client, key); err != nil || secret["User"] != data["User"] {
+				t.Fatalf("ReadSecret expected: %v after undelete, got: %v, %v", data, secret, err)
+			}
+			if _, err := UndeleteSecret(client, key); err == nil {
+				t.Fatal("UndeleteSecret expected: an error when the latest version is not deleted")
+			}
+		} else if _, err := UndeleteSecret(client, key); err == nil {
+			t.Fatal("UndeleteSecret expected: an error for KV v1")
+		}
+
+		if status, err := DestroySecret(client, key); err != nil || !status {
+			t.Fatalf("DestroySecret expected: %v, got: %v, %v", data, status, err)
+		}
 	}
 
 	for _, secretPath := range vaultSecretPaths {
@@ -63,3 +92,85 @@ func TestHelpers(t *testing.T) {
 		t.Fatalf("requiresRenewal expected: false")
 	}
 }
+
+func TestIsDeleted(t *testing.T) {
+	if isDeleted(api.KVVersionMetadata{Version: 1}) {
+		t.Fatal("expected: an active version to not be deleted")
+	}
+	if !isDeleted(api.KVVersionMetadata{Version: 1, DeletionTime: time.Now()}) {
+		t.Fatal("expected: a version with a deletion time to be deleted")
+	}
+	if !isDeleted(api.KVVersionMetadata{Version: 1, Destroyed: true}) {
+		t.Fatal("expected: a destroyed version to be deleted")
+	}
+}
+
+func TestSanitiseData(t *testing.T) {
+	data, err := sanitiseData(map[string]interface{}{"hostname": "example.com", "LegacyOption": "x"})
+	if err != nil {
+		t.Fatalf("expected: unknown options to be dropped, got: %v", err)
+	}
+	if _, ok := data["LegacyOption"]; ok || data["HostName"] != "example.com" || len(data) != 1 {
+		t.Fatalf("expected: map[HostName:example.com], got: %v", data)
+	}
+
+	if _, err := sanitiseData(map[string]interface{}{"Port": "ssh"}); err == nil {
+		t.Fatal("expected: an error for an invalid value")
+	}
+}
+
+func TestSecretVersions(t *testing.T) {
+	cluster, client := helpers.GetDummyCluster(t)
+	defer cluster.Cleanup()
+
+	for _, secretPath := range helpers.GetVaultSecretPaths() {
+		key := fmt.Sprintf("%s/%s", secretPath, "versioned")
+		isV2 := strings.HasSuffix(secretPath, "_v2")
+
+		for _, user := range []string{"first", "second"} {
+			if status, err := WriteSecret(client, key, map[string]interface{}{"User": user}); err != nil || !status {
+				t.Fatalf("WriteSecret expected: true, got: %v, %v", status, err)
+			}
+		}
+
+		versions, err := ListSecretVersions(client, key)
+		if !isV2 {
+			if err == nil {
+				t.Fatalf("ListSecretVersions expected: an error for %v, got: %v", secretPath, versions)
+			}
+			continue
+		}
+		if err != nil || len(versions) != 2 {
+			t.Fatalf("ListSecretVersions expected: 2 versions, got: %v, %v", versions, err)
+		}
+
+		if data, err := ReadSecretVersion(client, key, 1); err != nil || data["User"] != "first" {
+			t.Fatalf("ReadSecretVersion expected: first, got: %v, %v", data, err)
+		}
+
+		if status, err := WriteSecret(client, key, map[string]interface{}{"User": "first"}); err != nil || !status {
+			t.Fatalf("WriteSecret expected: true, got: %v, %v", status, err)
+		}
+
+		if data, err := ReadSecret(client, key); err != nil || data["User"] != "first" {
+			t.Fatalf("ReadSecret expected: first, got: %v, %v", data, err)
+		}
+
+		_, version, err := ReadSecretVersioned(client, key)
+		if err != nil || version != 3 {
+			t.Fatalf("ReadSecretVersioned expected: version 3, got: %v, %v", version, err)
+		}
+
+		if _, err := WriteSecretCAS(client, key, map[string]interface{}{"User": "third"}, 0); !errors.Is(err, ErrConflict) {
+			t.Fatalf("WriteSecretCAS expected: ErrConflict, got: %v", err)
+		}
+
+		if status, err := WriteSecretCAS(client, key, map[string]interface{}{"User": "third"}, version); err != nil || !status {
+			t.Fatalf("WriteSecretCAS expected: true, got: %v, %v", status, err)
+		}
+
+		if current, deleted, err := GetCurrentVersion(client, key); err != nil || current != 4 || deleted {
+			t.Fatalf("GetCurrentVersion expected: 4, false, got: %v, %v, %v", current, deleted, err)
+		}
+	}
+}